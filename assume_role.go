@@ -0,0 +1,67 @@
+package awsconfigfile
+
+import "fmt"
+
+// AssumeRoleProfile is a profile which assumes an IAM role
+// using credentials from another profile, such as an SSO profile
+// in a central tooling account.
+type AssumeRoleProfile struct {
+	// Account and role details
+	AccountID   string
+	AccountName string
+	RoleName    string
+	// RoleARN is the ARN of the role to assume.
+	// If empty, it is built from AccountID and RoleName.
+	RoleARN string
+
+	// SourceProfile is the name of the profile whose credentials
+	// are used to assume the role.
+	SourceProfile   string
+	ExternalID      string
+	RoleSessionName string
+	DurationSeconds int
+	MFASerial       string
+	Region          string
+	// GeneratedFrom is the source that the profile
+	// was created from, such as 'commonfate' or 'aws-sso'
+	GeneratedFrom string
+
+	// ExtraKeys are written to the profile after the standard keys.
+	// See MergeOpts.ExtraKeys for details.
+	ExtraKeys []KeyValue
+
+	// Metadata is additional information about the account and role,
+	// which can be used in profile name templates. It is not written to the config file.
+	Metadata Metadata
+}
+
+// ToIni converts a profile to a struct with `ini` tags
+// ready to be written to an ini config file.
+func (p AssumeRoleProfile) ToIni() any {
+	roleARN := p.RoleARN
+	if roleARN == "" {
+		roleARN = fmt.Sprintf("arn:aws:iam::%s:role/%s", p.AccountID, p.RoleName)
+	}
+
+	return &assumeRoleProfile{
+		RoleARN:                 roleARN,
+		SourceProfile:           p.SourceProfile,
+		CommonFateGeneratedFrom: p.GeneratedFrom,
+		ExternalID:              p.ExternalID,
+		RoleSessionName:         p.RoleSessionName,
+		DurationSeconds:         p.DurationSeconds,
+		MFASerial:               p.MFASerial,
+		Region:                  p.Region,
+	}
+}
+
+type assumeRoleProfile struct {
+	RoleARN                 string `ini:"role_arn"`
+	SourceProfile           string `ini:"source_profile"`
+	CommonFateGeneratedFrom string `ini:"common_fate_generated_from"`
+	ExternalID              string `ini:"external_id,omitempty"`
+	RoleSessionName         string `ini:"role_session_name,omitempty"`
+	DurationSeconds         int    `ini:"duration_seconds,omitempty"`
+	MFASerial               string `ini:"mfa_serial,omitempty"`
+	Region                  string `ini:"region,omitempty"`
+}
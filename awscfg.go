@@ -4,6 +4,10 @@ package awsconfigfile
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
 	"sort"
 	"strings"
 	"text/template"
@@ -27,6 +31,42 @@ type SSOProfile struct {
 	// GeneratedFrom is the source that the profile
 	// was created from, such as 'commonfate' or 'aws-sso'
 	GeneratedFrom string
+
+	// ExtraKeys are written to the profile after the standard keys.
+	// See MergeOpts.ExtraKeys for details.
+	ExtraKeys []KeyValue
+
+	// Metadata is additional information about the account and role,
+	// which can be used in profile name templates. It is not written to the config file.
+	Metadata Metadata
+}
+
+// KeyValue is a key and value in a config section.
+type KeyValue struct {
+	Key   string
+	Value string
+	// Nested are the lines of a sub-section, such as 'max_concurrent_requests = 20'
+	// for an 's3' key, which are written indented on the lines after the key.
+	// Value must be empty if Nested is set.
+	Nested []string
+}
+
+// fullValue returns the value followed by any nested values,
+// so that keys with nested values can be compared.
+func (kv KeyValue) fullValue() string {
+	return joinNestedValues(kv.Value, kv.Nested)
+}
+
+// keyFullValue returns the value of key followed by any nested values.
+func keyFullValue(key *ini.Key) string {
+	return joinNestedValues(key.Value(), key.NestedValues())
+}
+
+func joinNestedValues(value string, nested []string) string {
+	for _, n := range nested {
+		value += "\n  " + n
+	}
+	return value
 }
 
 // ToIni converts a profile to a struct with `ini` tags
@@ -39,6 +79,26 @@ type SSOProfile struct {
 // for use with the Granted credential process, like granted_sso_role_name,
 // granted_sso_start_url, and so forth.
 func (p SSOProfile) ToIni(profileName string, noCredentialProcess bool) any {
+	return p.toIni(profileName, "", noCredentialProcess)
+}
+
+// toIni is the same as ToIni, but references the provided sso-session
+// rather than writing sso_start_url and sso_region to the profile.
+//
+// Profiles using the Granted credential process always contain
+// the SSO start URL and region, as the AWS CLI attempts to use
+// native SSO for any profile containing sso_session.
+func (p SSOProfile) toIni(profileName string, ssoSession string, noCredentialProcess bool) any {
+	if noCredentialProcess && ssoSession != "" {
+		return &ssoSessionProfile{
+			SSOSession:              ssoSession,
+			SSOAccountID:            p.AccountID,
+			SSORoleName:             p.RoleName,
+			CommonFateGeneratedFrom: p.GeneratedFrom,
+			Region:                  p.Region,
+		}
+	}
+
 	if noCredentialProcess {
 		return &regularProfile{
 			SSOStartURL:             p.SSOStartURL,
@@ -68,80 +128,1026 @@ func (p SSOProfile) ToIni(profileName string, noCredentialProcess bool) any {
 }
 
 type MergeOpts struct {
-	Config              *ini.File
-	Prefix              string
-	Profiles            []SSOProfile
+	Config   *ini.File
+	Prefix   string
+	Profiles []SSOProfile
+	// SectionNameTemplate is executed with each profile to name its section.
+	// Defaults to '{{ .AccountName }}/{{ .RoleName }}'. Profile metadata is available
+	// with methods such as '{{ .OU }}' and '{{ .Tag "environment" }}'.
 	SectionNameTemplate string
 	NoCredentialProcess bool
 	// PruneStartURLs is a slice of AWS SSO start URLs which profiles are being generated for.
 	// Existing profiles with these start URLs will be removed if they aren't found in the Profiles field.
 	PruneStartURLs []string
+	// SSOSessions causes generated profiles to reference a shared [sso-session] section
+	// with the sso_session key, rather than repeating sso_start_url and sso_region in each profile.
+	// One sso-session section is written for each unique SSO start URL and SSO region.
+	//
+	// SSOSessions only applies when NoCredentialProcess is true.
+	SSOSessions bool
+	// SSOSessionNameTemplate is used to name the generated sso-session sections.
+	// The template is executed with an SSOSession. If empty, the name is derived
+	// from the SSO start URL, such as 'example' for 'https://example.awsapps.com/start'.
+	SSOSessionNameTemplate string
+	// SSORegistrationScopes is written to sso_registration_scopes in generated sso-session sections.
+	// Defaults to 'sso:account:access'.
+	SSORegistrationScopes string
+	// AssumeRoleProfiles are written after Profiles, and are named and sorted
+	// using the same SectionNameTemplate.
+	// Generated assume role profiles are pruned if the SSO start URL of their
+	// source_profile (or the source_profile's own source_profile, and so on)
+	// is in PruneStartURLs.
+	AssumeRoleProfiles []AssumeRoleProfile
+	// ExternalSourceProfiles are profile names which exist outside of the config file,
+	// such as in ~/.aws/credentials. Assume role profiles may use these as their source_profile.
+	ExternalSourceProfiles []string
+	// MergePolicy controls how existing profiles are updated.
+	// Defaults to MergePolicyReplace.
+	MergePolicy MergePolicy
+	// KeyConflictStrategy controls how keys are updated when MergePolicy is MergePolicyPreserve
+	// and the existing value of a key differs from the generated value.
+	// Defaults to KeyConflictOverwrite.
+	KeyConflictStrategy KeyConflictStrategy
+	// CollisionStrategy controls what happens when more than one profile has the same name,
+	// or when a profile has the same name as a profile written by hand.
+	// Defaults to CollisionFail.
+	CollisionStrategy CollisionStrategy
+	// ExtraKeys are written to every generated profile after the standard keys,
+	// followed by the ExtraKeys of the profile itself, such as 'output = json'.
+	// Values are templates which are executed with the profile, in the same way as SectionNameTemplate.
+	//
+	// Extra keys must not replace keys which are already written by the generator.
+	// Sub-sections such as 's3 =' are written with KeyValue.Nested, and require
+	// Config to allow nested values, as configs loaded with LoadConfig do.
+	ExtraKeys []KeyValue
+	// Validation controls how invalid profiles are handled.
+	// See SSOProfile.Validate for the checks which are made.
+	// Defaults to ValidationOff, so that profiles are only validated if a mode is set.
+	Validation ValidationMode
+	// ExtraRegions are accepted when validating profiles, in addition to the known AWS regions.
+	ExtraRegions []string
+	// Lint runs Lint on the merged config file before it is modified,
+	// and Merge returns a *LintError without modifying Config if there are any errors.
+	// Warnings are ignored.
+	Lint bool
+}
+
+// MergePolicy controls how Merge updates existing profiles.
+type MergePolicy string
+
+const (
+	// MergePolicyReplace removes and rewrites existing profiles,
+	// so that any keys or comments added by hand are removed.
+	MergePolicyReplace MergePolicy = "replace"
+	// MergePolicyPreserve only updates the keys written by the generator,
+	// keeping any other keys and comments in place.
+	// The keys written by the generator are tracked in the common_fate_generated_keys key,
+	// so that keys which are no longer generated can be removed, and a hash of each generated
+	// value is tracked in the common_fate_value_hashes key, so that keys which have been
+	// edited by hand can be told apart from keys whose generated value has changed.
+	// Keys which have been edited by hand are never removed.
+	MergePolicyPreserve MergePolicy = "preserve"
+)
+
+// KeyConflictStrategy controls how Merge updates a key with the MergePolicyPreserve policy
+// when the key has been edited by hand and has a different value to the generated value.
+// Keys which still have their last generated value are always updated.
+type KeyConflictStrategy string
+
+const (
+	// KeyConflictOverwrite replaces the existing value with the generated value.
+	KeyConflictOverwrite KeyConflictStrategy = "overwrite"
+	// KeyConflictKeepExisting keeps the existing value.
+	// The key is no longer tracked as generated, so it is kept if the generator stops writing it.
+	KeyConflictKeepExisting KeyConflictStrategy = "keep-existing"
+	// KeyConflictFail causes Merge to return a *KeyConflictError
+	// without modifying the config file.
+	KeyConflictFail KeyConflictStrategy = "error"
+)
+
+// KeyConflict is a key in an existing profile which has been edited by hand
+// and has a different value to the generated value.
+type KeyConflict struct {
+	Profile   string
+	Key       string
+	Existing  string
+	Generated string
 }
 
+// KeyConflictError is returned by Merge if there are key conflicts
+// and KeyConflictStrategy is KeyConflictFail.
+type KeyConflictError struct {
+	Conflicts []KeyConflict
+}
+
+func (e *KeyConflictError) Error() string {
+	var msgs []string
+	for _, c := range e.Conflicts {
+		msgs = append(msgs, fmt.Sprintf("profile %s: %s is %q but the generated value is %q", c.Profile, c.Key, c.Existing, c.Generated))
+	}
+	return "existing profiles have been modified: " + strings.Join(msgs, "; ")
+}
+
+// generatedKeysKey lists the keys written by the generator
+// when the MergePolicyPreserve policy is used.
+const generatedKeysKey = "common_fate_generated_keys"
+
+// generatedHashesKey lists a hash of the last generated value of each key
+// in generatedKeysKey, as 'key:hash' pairs.
+const generatedHashesKey = "common_fate_value_hashes"
+
+// ownedKeys are the keys which are always written by the generator. They are treated as
+// generated in sections which were generated without the MergePolicyPreserve policy, or by
+// older versions, which don't have generatedKeysKey. Optional keys such as region may have been
+// added by hand, so they are kept.
+var ownedKeys = []string{
+	"sso_start_url", "sso_region", "sso_account_id", "sso_role_name", "sso_session",
+	"granted_sso_start_url", "granted_sso_region", "granted_sso_account_id", "granted_sso_role_name",
+	"credential_process", "role_arn", "source_profile", "common_fate_generated_from",
+}
+
+// generatedKeys returns the names of the keys in section which were last written by the generator,
+// and a hash of the last generated value of each key.
+//
+// Sections generated without tracking keys are treated as if the ownedKeys they contain
+// were generated with their current values.
+func generatedKeys(section *ini.Section) ([]string, map[string]string) {
+	if section.HasKey(generatedKeysKey) || !section.HasKey("common_fate_generated_from") {
+		return splitKeyNames(keyValue(section, generatedKeysKey)), splitKeyHashes(keyValue(section, generatedHashesKey))
+	}
+
+	var names []string
+	hashes := map[string]string{}
+	for _, name := range ownedKeys {
+		if section.HasKey(name) {
+			names = append(names, name)
+			hashes[name] = hashValue(keyFullValue(section.Key(name)))
+		}
+	}
+	return names, hashes
+}
+
+// SSOSession is an [sso-session] section which is
+// shared between profiles with the same SSO start URL and region.
+type SSOSession struct {
+	Name               string
+	SSOStartURL        string
+	SSORegion          string
+	RegistrationScopes string
+	// GeneratedFrom is the source that the session
+	// was created from, such as 'commonfate' or 'aws-sso'
+	GeneratedFrom string
+}
+
+// ToIni converts an SSO session to a struct with `ini` tags
+// ready to be written to an ini config file.
+func (s SSOSession) ToIni() any {
+	return &ssoSessionSection{
+		SSOStartURL:             s.SSOStartURL,
+		SSORegion:               s.SSORegion,
+		SSORegistrationScopes:   s.RegistrationScopes,
+		CommonFateGeneratedFrom: s.GeneratedFrom,
+	}
+}
+
+const defaultSSORegistrationScopes = "sso:account:access"
+
+// Merge generated profiles into the config file in opts.Config.
+//
+// If invalid profiles are skipped because opts.Validation is ValidationSkip, or profile name
+// collisions are resolved using opts.CollisionStrategy, the config is updated and
+// a *PartialFailureError listing them is returned.
 func Merge(opts MergeOpts) error {
+	if opts.Lint {
+		// the profiles are merged into a copy of the config first,
+		// so that the config is left untouched if the result has errors.
+		_, err := Plan(opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := merge(opts)
+	if err != nil {
+		return err
+	}
+	if len(result.Skipped) > 0 || len(result.Collisions) > 0 {
+		return &PartialFailureError{Skipped: result.Skipped, Collisions: result.Collisions}
+	}
+	return nil
+}
+
+// mergeResult records the changes made by merge.
+type mergeResult struct {
+	// Written is the names of the sections which were written by merge.
+	Written []string
+	// Collisions which were resolved using the CollisionStrategy.
+	Collisions []Collision
+	// Skipped is the invalid profiles which were skipped.
+	Skipped []InvalidProfile
+	// Entries are the profiles which were written, in the order they were written.
+	Entries []profileEntry
+}
+
+func merge(opts MergeOpts) (*mergeResult, error) {
+	var result mergeResult
+	var err error
+
 	if opts.SectionNameTemplate == "" {
 		opts.SectionNameTemplate = "{{ .AccountName }}/{{ .RoleName }}"
 	}
+	if opts.SSORegistrationScopes == "" {
+		opts.SSORegistrationScopes = defaultSSORegistrationScopes
+	}
+	if opts.MergePolicy == "" {
+		opts.MergePolicy = MergePolicyReplace
+	}
+	if opts.KeyConflictStrategy == "" {
+		opts.KeyConflictStrategy = KeyConflictOverwrite
+	}
+	if opts.CollisionStrategy == "" {
+		opts.CollisionStrategy = CollisionFail
+	}
+	switch opts.CollisionStrategy {
+	case CollisionFail, CollisionFirstWins, CollisionSuffixAccountID, CollisionSuffixCounter:
+	default:
+		return nil, fmt.Errorf("invalid collision strategy %q", opts.CollisionStrategy)
+	}
+	switch opts.MergePolicy {
+	case MergePolicyReplace, MergePolicyPreserve:
+	default:
+		return nil, fmt.Errorf("invalid merge policy %q", opts.MergePolicy)
+	}
+	switch opts.KeyConflictStrategy {
+	case KeyConflictOverwrite, KeyConflictKeepExisting, KeyConflictFail:
+	default:
+		return nil, fmt.Errorf("invalid key conflict strategy %q", opts.KeyConflictStrategy)
+	}
 
-	// Sort profiles by CombinedName (AccountName/RoleName)
-	sort.SliceStable(opts.Profiles, func(i, j int) bool {
-		combinedNameI := opts.Profiles[i].AccountName + "/" + opts.Profiles[i].RoleName
-		combinedNameJ := opts.Profiles[j].AccountName + "/" + opts.Profiles[j].RoleName
-		return combinedNameI < combinedNameJ
+	profiles := opts.Profiles
+	opts.Profiles, result.Skipped, err = validateProfiles(profiles, opts.Validation, opts.ExtraRegions, func(i int) string {
+		return profiles[i].GeneratedFrom
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	funcMap := sprig.TxtFuncMap()
 	sectionNameTempl, err := template.New("").Funcs(funcMap).Parse(opts.SectionNameTemplate)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// remove any config sections that have 'common_fate_generated_from' as a key
-	for _, sec := range opts.Config.Sections() {
-		var startURL string
+	extraKeys, err := parseExtraKeys(opts.ExtraKeys)
+	if err != nil {
+		return nil, err
+	}
 
-		if sec.HasKey("granted_sso_start_url") {
-			startURL = sec.Key("granted_sso_start_url").String()
-		} else if sec.HasKey("sso_start_url") {
-			startURL = sec.Key("sso_start_url").String()
+	useSSOSessions := opts.SSOSessions && opts.NoCredentialProcess
+
+	var sessions map[ssoSessionKey]SSOSession
+	if useSSOSessions {
+		sessions, err = buildSSOSessions(opts)
+		if err != nil {
+			return nil, err
 		}
+		err = checkSSOSessions(opts.Config, sessions)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		for _, pruneURL := range opts.PruneStartURLs {
-			isGenerated := sec.HasKey("common_fate_generated_from") // true if the profile was created automatically.
+	// render every profile before the config is modified,
+	// so that the config is left untouched if any profile is invalid.
+	var entries []profileEntry
 
-			if isGenerated && startURL == pruneURL {
-				opts.Config.DeleteSection(sec.Name())
+	for _, ssoProfile := range opts.Profiles {
+		combinedName := ssoProfile.AccountName + "/" + ssoProfile.RoleName
+		ssoProfile.AccountName = normalizeAccountName(ssoProfile.AccountName)
+		profileName, err := renderProfileName(sectionNameTempl, opts.Prefix, ssoProfile)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, profileEntry{ProfileName: profileName, Profile: ssoProfile, combinedName: combinedName})
+	}
+
+	for _, roleProfile := range opts.AssumeRoleProfiles {
+		combinedName := roleProfile.AccountName + "/" + roleProfile.RoleName
+		roleProfile.AccountName = normalizeAccountName(roleProfile.AccountName)
+		profileName, err := renderProfileName(sectionNameTempl, opts.Prefix, roleProfile)
+		if err != nil {
+			return nil, err
+		}
+
+		if roleProfile.SourceProfile == "" {
+			return nil, fmt.Errorf("assume role profile %s has no source profile", profileName)
+		}
+		entries = append(entries, profileEntry{ProfileName: profileName, Profile: roleProfile, SourceProfile: roleProfile.SourceProfile, combinedName: combinedName})
+	}
+
+	// collisions are resolved before the keys are rendered, as the credential_process key
+	// contains the profile name. Profiles are considered in the order they were given,
+	// so that profiles from sources added first win, and are sorted afterwards.
+	entries, result.Collisions, err = resolveCollisions(opts.Config, entries, opts.CollisionStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort profiles by CombinedName (AccountName/RoleName), with SSO profiles before assume role profiles
+	sort.SliceStable(entries, func(i, j int) bool {
+		_, roleI := entries[i].Profile.(AssumeRoleProfile)
+		_, roleJ := entries[j].Profile.(AssumeRoleProfile)
+		if roleI != roleJ {
+			return roleJ
+		}
+		return entries[i].combinedName < entries[j].combinedName
+	})
+
+	for i, entry := range entries {
+		var values any
+		var profileExtraKeys []extraKeyTemplate
+
+		switch p := entry.Profile.(type) {
+		case SSOProfile:
+			var sessionName string
+			if useSSOSessions {
+				s := sessions[ssoSessionKey{StartURL: p.SSOStartURL, Region: p.SSORegion}]
+				entries[i].Session = &s
+				sessionName = s.Name
 			}
+			values = p.toIni(entry.ProfileName, sessionName, opts.NoCredentialProcess)
+			profileExtraKeys, err = parseExtraKeys(p.ExtraKeys)
+		case AssumeRoleProfile:
+			values = p.ToIni()
+			profileExtraKeys, err = parseExtraKeys(p.ExtraKeys)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", entry.ProfileName, err)
+		}
+
+		entries[i].Keys, err = renderKeys(values, entry.Profile, extraKeys, profileExtraKeys)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", entry.ProfileName, err)
 		}
 	}
 
-	for _, ssoProfile := range opts.Profiles {
-		ssoProfile.AccountName = normalizeAccountName(ssoProfile.AccountName)
-		sectionNameBuffer := bytes.NewBufferString("")
-		err := sectionNameTempl.Execute(sectionNameBuffer, ssoProfile)
+	pruned := sectionsToPrune(opts.Config, opts.PruneStartURLs)
+	// profiles which are being regenerated are updated rather than pruned,
+	// so that the MergePolicyPreserve policy can keep their existing keys.
+	for _, entry := range entries {
+		delete(pruned, "profile "+entry.ProfileName)
+	}
+	// existing profiles are kept if the generated profile is skipped because it is invalid,
+	// so that a source returning a bad profile doesn't remove a working one.
+	for _, invalid := range result.Skipped {
+		p := invalid.Profile
+		p.AccountName = normalizeAccountName(p.AccountName)
+		if name, err := renderProfileName(sectionNameTempl, opts.Prefix, p); err == nil {
+			delete(pruned, "profile "+name)
+		}
+	}
+
+	err = checkSourceProfiles(opts.Config, entries, pruned, opts.ExternalSourceProfiles)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.MergePolicy == MergePolicyPreserve && opts.KeyConflictStrategy == KeyConflictFail {
+		err = checkKeyConflicts(opts.Config, entries)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	// remove any config sections that have 'common_fate_generated_from' as a key
+	for name := range pruned {
+		opts.Config.DeleteSection(name)
+	}
+
+	writtenSessions := map[string]bool{}
+
+	for _, entry := range entries {
+		if entry.Session != nil && !writtenSessions[entry.Session.Name] {
+			err = writeSSOSession(opts.Config, *entry.Session)
+			if err != nil {
+				return nil, err
+			}
+			writtenSessions[entry.Session.Name] = true
+			result.Written = append(result.Written, "sso-session "+entry.Session.Name)
+		}
+
+		sectionName := "profile " + entry.ProfileName
+
+		existing, err := opts.Config.GetSection(sectionName)
+		if err == nil && opts.MergePolicy == MergePolicyPreserve {
+			err = updateSection(existing, entry.Keys, opts.KeyConflictStrategy)
+			if err != nil {
+				return nil, err
+			}
+			result.Written = append(result.Written, sectionName)
+			continue
 		}
-		profileName := opts.Prefix + sectionNameBuffer.String()
-		sectionName := "profile " + profileName
 
 		opts.Config.DeleteSection(sectionName)
 		section, err := opts.Config.NewSection(sectionName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, kv := range entry.Keys {
+			err = newKey(section, kv)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if opts.MergePolicy == MergePolicyPreserve {
+			err = writeGeneratedKeys(section, entry.Keys)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.Written = append(result.Written, sectionName)
+	}
+
+	pruneSSOSessions(opts.Config, opts.PruneStartURLs)
+
+	result.Entries = entries
+	return &result, nil
+}
+
+// profileEntry is a rendered profile which is ready to be written to the config file.
+type profileEntry struct {
+	ProfileName string
+	// Profile is the SSOProfile or AssumeRoleProfile which the entry is rendered from.
+	Profile any
+	// Keys are the keys to write to the profile, in order.
+	Keys []KeyValue
+	// Session is the sso-session referenced by the profile, if any.
+	Session *SSOSession
+	// SourceProfile is the source_profile of an assume role profile.
+	SourceProfile string
+	// combinedName is the AccountName/RoleName of the profile before it is normalized,
+	// which entries are sorted by.
+	combinedName string
+}
+
+// renderProfileName executes the profile name template for a profile.
+func renderProfileName(templ *template.Template, prefix string, profile any) (string, error) {
+	sectionNameBuffer := bytes.NewBufferString("")
+	err := templ.Execute(sectionNameBuffer, profile)
+	if err != nil {
+		return "", err
+	}
+	return prefix + sectionNameBuffer.String(), nil
+}
+
+// updateSection updates the generated keys in an existing section, keeping any other keys.
+// Keys which were previously generated, but are no longer, are removed
+// unless they have been edited by hand since they were generated.
+// See generatedKeys for how sections written without tracking keys are handled.
+func updateSection(section *ini.Section, keys []KeyValue, strategy KeyConflictStrategy) error {
+	generated := map[string]bool{}
+	for _, kv := range keys {
+		generated[kv.Key] = true
+	}
+
+	names, hashes := generatedKeys(section)
+
+	for _, name := range names {
+		if generated[name] || !section.HasKey(name) {
+			continue
+		}
+		if hash, ok := hashes[name]; ok && hashValue(keyFullValue(section.Key(name))) != hash {
+			continue
+		}
+		section.DeleteKey(name)
+	}
+
+	// tracked are the keys written by the generator. Keys which are kept because
+	// they were edited by hand are left out, so that they are never removed.
+	var tracked []KeyValue
+
+	for _, kv := range keys {
+		if strategy == KeyConflictKeepExisting && isEditedByHand(section, hashes, kv) {
+			continue
+		}
+		tracked = append(tracked, kv)
+
+		if section.HasKey(kv.Key) {
+			key := section.Key(kv.Key)
+			if keyFullValue(key) == kv.fullValue() {
+				continue
+			}
+			if len(key.NestedValues()) == 0 && len(kv.Nested) == 0 {
+				// SetValue keeps any comment attached to the key.
+				key.SetValue(kv.Value)
+				continue
+			}
+			// nested values can't be replaced, so the key is written again.
+			section.DeleteKey(kv.Key)
+		}
+
+		err := newKey(section, kv)
 		if err != nil {
 			return err
 		}
+	}
+
+	// the tracking keys are moved to the end of the section, after any newly added keys.
+	section.DeleteKey(generatedKeysKey)
+	section.DeleteKey(generatedHashesKey)
+	return writeGeneratedKeys(section, tracked)
+}
+
+// newKey adds a key and its nested values to section.
+func newKey(section *ini.Section, kv KeyValue) error {
+	key, err := section.NewKey(kv.Key, kv.Value)
+	if err != nil {
+		return err
+	}
+	for _, n := range kv.Nested {
+		err = key.AddNestedValue(n)
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", kv.Key, err)
+		}
+	}
+	return nil
+}
+
+// writeGeneratedKeys writes the keys which track the generated keys and their values.
+func writeGeneratedKeys(section *ini.Section, keys []KeyValue) error {
+	_, err := section.NewKey(generatedKeysKey, joinKeyNames(keys))
+	if err != nil {
+		return err
+	}
+	_, err = section.NewKey(generatedHashesKey, joinKeyHashes(keys))
+	return err
+}
+
+// isEditedByHand returns true if the key in section has a different value to the generated value,
+// and the value is not the last generated value recorded in hashes.
+// Keys without a recorded hash, such as those written by older versions, are assumed to be edited
+// if they have a different value to the generated value.
+func isEditedByHand(section *ini.Section, hashes map[string]string, kv KeyValue) bool {
+	if !section.HasKey(kv.Key) {
+		return false
+	}
+	value := keyFullValue(section.Key(kv.Key))
+	if value == kv.fullValue() {
+		return false
+	}
+	if hash, ok := hashes[kv.Key]; ok {
+		return hashValue(value) != hash
+	}
+	return true
+}
+
+// checkKeyConflicts returns a *KeyConflictError if any existing profiles have a key
+// which has been edited by hand and has a different value to the generated value.
+func checkKeyConflicts(config *ini.File, entries []profileEntry) error {
+	var conflicts []KeyConflict
+
+	for _, entry := range entries {
+		section, err := config.GetSection("profile " + entry.ProfileName)
+		if err != nil {
+			continue
+		}
+
+		_, hashes := generatedKeys(section)
+
+		for _, kv := range entry.Keys {
+			if isEditedByHand(section, hashes, kv) {
+				conflicts = append(conflicts, KeyConflict{
+					Profile:   entry.ProfileName,
+					Key:       kv.Key,
+					Existing:  keyFullValue(section.Key(kv.Key)),
+					Generated: kv.fullValue(),
+				})
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return &KeyConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+func joinKeyNames(keys []KeyValue) string {
+	names := make([]string, len(keys))
+	for i, kv := range keys {
+		names[i] = kv.Key
+	}
+	return strings.Join(names, ",")
+}
+
+// joinKeyHashes returns the value of generatedHashesKey for keys.
+func joinKeyHashes(keys []KeyValue) string {
+	pairs := make([]string, len(keys))
+	for i, kv := range keys {
+		pairs[i] = kv.Key + ":" + hashValue(kv.fullValue())
+	}
+	return strings.Join(pairs, ",")
+}
+
+// splitKeyHashes parses the value of generatedHashesKey into a map of key names to hashes.
+func splitKeyHashes(s string) map[string]string {
+	hashes := map[string]string{}
+	for _, pair := range splitKeyNames(s) {
+		name, hash, ok := strings.Cut(pair, ":")
+		if ok {
+			hashes[name] = hash
+		}
+	}
+	return hashes
+}
+
+// hashValue returns a short hash of a generated value. It only needs to tell
+// whether a value has changed, so a prefix of the SHA256 hash is used.
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:4])
+}
 
-		entry := ssoProfile.ToIni(profileName, opts.NoCredentialProcess)
-		err = section.ReflectFrom(entry)
+func splitKeyNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// extraKeyTemplate is a parsed extra key.
+type extraKeyTemplate struct {
+	Key    string
+	Value  *template.Template
+	Nested []*template.Template
+}
+
+// parseExtraKeys parses the values of extra keys as templates.
+func parseExtraKeys(extraKeys []KeyValue) ([]extraKeyTemplate, error) {
+	var parsed []extraKeyTemplate
+
+	for _, kv := range extraKeys {
+		if kv.Key == "" || strings.ContainsAny(kv.Key, "=:[];#\r\n\t ") {
+			return nil, fmt.Errorf("invalid extra key %q", kv.Key)
+		}
+		if kv.Key == generatedKeysKey || kv.Key == generatedHashesKey {
+			return nil, fmt.Errorf("extra key %s is reserved", kv.Key)
+		}
+
+		if kv.Value != "" && len(kv.Nested) > 0 {
+			return nil, fmt.Errorf("extra key %s must not have both a value and nested values", kv.Key)
+		}
+
+		templ, err := template.New(kv.Key).Funcs(sprig.TxtFuncMap()).Parse(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing extra key %s: %w", kv.Key, err)
+		}
+		extra := extraKeyTemplate{Key: kv.Key, Value: templ}
+
+		for _, n := range kv.Nested {
+			templ, err := template.New(kv.Key).Funcs(sprig.TxtFuncMap()).Parse(n)
+			if err != nil {
+				return nil, fmt.Errorf("parsing extra key %s: %w", kv.Key, err)
+			}
+			extra.Nested = append(extra.Nested, templ)
+		}
+		parsed = append(parsed, extra)
+	}
+
+	return parsed, nil
+}
+
+// renderKeys returns the keys of a struct with `ini` tags in order,
+// followed by the extra keys which are executed with the profile.
+func renderKeys(values any, profile any, extraKeys ...[]extraKeyTemplate) ([]KeyValue, error) {
+	// reflect into a scratch section, so that the ordering and omitempty
+	// behaviour of the `ini` tags is the same as section.ReflectFrom.
+	scratch, err := ini.Empty().NewSection("scratch")
+	if err != nil {
+		return nil, err
+	}
+	err = scratch.ReflectFrom(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []KeyValue
+	generated := map[string]bool{}
+	for _, key := range scratch.Keys() {
+		keys = append(keys, KeyValue{Key: key.Name(), Value: key.Value()})
+		generated[key.Name()] = true
+	}
+
+	// extra keys which appear more than once replace the earlier value,
+	// so that profile extra keys can override MergeOpts.ExtraKeys.
+	extraIndex := map[string]int{}
+
+	for _, templates := range extraKeys {
+		for _, extra := range templates {
+			if generated[extra.Key] {
+				return nil, fmt.Errorf("extra key %s conflicts with a generated key", extra.Key)
+			}
+
+			kv := KeyValue{Key: extra.Key}
+			for i, templ := range append([]*template.Template{extra.Value}, extra.Nested...) {
+				var b bytes.Buffer
+				err := templ.Execute(&b, profile)
+				if err != nil {
+					return nil, fmt.Errorf("rendering extra key %s: %w", extra.Key, err)
+				}
+				value := b.String()
+				if strings.ContainsAny(value, "\r\n") {
+					return nil, fmt.Errorf("extra key %s must not contain multiple lines", extra.Key)
+				}
+				if i == 0 {
+					kv.Value = value
+				} else {
+					kv.Nested = append(kv.Nested, value)
+				}
+			}
+
+			if i, ok := extraIndex[extra.Key]; ok {
+				keys[i] = kv
+				continue
+			}
+			extraIndex[extra.Key] = len(keys)
+			keys = append(keys, kv)
+		}
+	}
+
+	return keys, nil
+}
+
+// sectionsToPrune returns the names of generated sections with one of the pruneStartURLs.
+// sso-session sections are not included, as they are removed by pruneSSOSessions
+// once they are no longer referenced by any profiles.
+func sectionsToPrune(config *ini.File, pruneStartURLs []string) map[string]bool {
+	pruned := map[string]bool{}
+
+	for _, sec := range config.Sections() {
+		isGenerated := sec.HasKey("common_fate_generated_from") // true if the profile was created automatically.
+		if !isGenerated || isSSOSessionSection(sec.Name()) {
+			continue
+		}
+
+		startURL := sectionStartURL(config, sec)
+
+		for _, pruneURL := range pruneStartURLs {
+			if startURL == pruneURL {
+				pruned[sec.Name()] = true
+			}
+		}
+	}
+
+	return pruned
+}
+
+// checkSourceProfiles returns an error if the source_profile of an assume role profile
+// will not exist in the config file after merging.
+func checkSourceProfiles(config *ini.File, entries []profileEntry, pruned map[string]bool, external []string) error {
+	exists := map[string]bool{}
+	for _, sec := range config.Sections() {
+		if !pruned[sec.Name()] {
+			exists[sec.Name()] = true
+		}
+	}
+	for _, entry := range entries {
+		exists["profile "+entry.ProfileName] = true
+	}
+	for _, name := range external {
+		exists["profile "+name] = true
+	}
+
+	for _, entry := range entries {
+		if entry.SourceProfile == "" {
+			continue
+		}
+		if exists["profile "+entry.SourceProfile] {
+			continue
+		}
+		// the default profile is written as [default] rather than [profile default]
+		if entry.SourceProfile == "default" && exists["default"] {
+			continue
+		}
+		return fmt.Errorf("source profile %s of profile %s does not exist", entry.SourceProfile, entry.ProfileName)
+	}
+
+	return nil
+}
+
+// ssoSessionKey uniquely identifies an sso-session.
+type ssoSessionKey struct {
+	StartURL string
+	Region   string
+}
+
+// buildSSOSessions groups the profiles by SSO start URL and region
+// and names an sso-session for each group.
+func buildSSOSessions(opts MergeOpts) (map[ssoSessionKey]SSOSession, error) {
+	var nameTempl *template.Template
+	if opts.SSOSessionNameTemplate != "" {
+		var err error
+		nameTempl, err = template.New("").Funcs(sprig.TxtFuncMap()).Parse(opts.SSOSessionNameTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sessions := map[ssoSessionKey]SSOSession{}
+	// keys are kept in the order they are found so that naming is deterministic.
+	var keys []ssoSessionKey
+
+	for _, p := range opts.Profiles {
+		key := ssoSessionKey{StartURL: p.SSOStartURL, Region: p.SSORegion}
+		if _, ok := sessions[key]; ok {
+			continue
+		}
+		keys = append(keys, key)
+		sessions[key] = SSOSession{
+			SSOStartURL:        p.SSOStartURL,
+			SSORegion:          p.SSORegion,
+			RegistrationScopes: opts.SSORegistrationScopes,
+			GeneratedFrom:      p.GeneratedFrom,
+		}
+	}
+
+	// count how many sessions share each default name, so that
+	// sessions for the same start URL in different regions can be told apart.
+	defaultNames := map[string]int{}
+	for _, key := range keys {
+		defaultNames[defaultSSOSessionName(key.StartURL)]++
+	}
+
+	names := map[string]ssoSessionKey{}
+	for _, key := range keys {
+		session := sessions[key]
+
+		if nameTempl != nil {
+			var b bytes.Buffer
+			err := nameTempl.Execute(&b, session)
+			if err != nil {
+				return nil, err
+			}
+			session.Name = b.String()
+		} else {
+			session.Name = defaultSSOSessionName(key.StartURL)
+			if defaultNames[session.Name] > 1 {
+				session.Name += "-" + key.Region
+			}
+		}
+
+		if session.Name == "" {
+			return nil, fmt.Errorf("sso-session name for start URL %s and region %s is empty", key.StartURL, key.Region)
+		}
+		if strings.ContainsAny(session.Name, profileSectionIllegalChars) {
+			return nil, fmt.Errorf("sso-session name %q must not contain any of these illegal characters (%s)", session.Name, profileSectionIllegalChars)
+		}
+		if existing, ok := names[session.Name]; ok {
+			return nil, fmt.Errorf("sso-session name %q is used for both start URL %s (%s) and %s (%s)", session.Name, existing.StartURL, existing.Region, key.StartURL, key.Region)
+		}
+		names[session.Name] = key
+		sessions[key] = session
+	}
+
+	return sessions, nil
+}
+
+// defaultSSOSessionName derives an sso-session name from an SSO start URL.
+// 'https://example.awsapps.com/start' is named 'example', and other URLs
+// are named after their hostname, such as 'sso-example-com' for 'https://sso.example.com/start'.
+func defaultSSOSessionName(startURL string) string {
+	host := startURL
+	u, err := url.Parse(startURL)
+	if err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+
+	if name, ok := cutSuffix(host, ".awsapps.com"); ok {
+		return name
+	}
+	return strings.ReplaceAll(host, ".", "-")
+}
+
+// checkSSOSessions returns an error if a hand-written sso-session section has the same name
+// as a generated session, but a different start URL or region.
+func checkSSOSessions(config *ini.File, sessions map[ssoSessionKey]SSOSession) error {
+	for _, session := range sessions {
+		sectionName := "sso-session " + session.Name
+
+		section, err := config.GetSection(sectionName)
+		if err != nil || section.HasKey("common_fate_generated_from") {
+			continue
+		}
+
+		if section.Key("sso_start_url").String() != session.SSOStartURL || section.Key("sso_region").String() != session.SSORegion {
+			return fmt.Errorf("existing [%s] section does not match SSO start URL %s and region %s", sectionName, session.SSOStartURL, session.SSORegion)
+		}
+	}
+	return nil
+}
+
+// writeSSOSession adds or updates the [sso-session] section for the session.
+// A hand-written sso-session section with the same name is reused
+// rather than being overwritten.
+func writeSSOSession(config *ini.File, session SSOSession) error {
+	sectionName := "sso-session " + session.Name
+
+	section, err := config.GetSection(sectionName)
+	if err != nil {
+		section, err = config.NewSection(sectionName)
 		if err != nil {
 			return err
 		}
+	} else if !section.HasKey("common_fate_generated_from") {
+		return nil
+	}
+
+	return section.ReflectFrom(session.ToIni())
+}
+
+// pruneSSOSessions removes generated sso-session sections with one of the pruneStartURLs
+// which are no longer referenced by any profile.
+func pruneSSOSessions(config *ini.File, pruneStartURLs []string) {
+	referenced := map[string]bool{}
+	for _, sec := range config.Sections() {
+		if sec.HasKey("sso_session") {
+			referenced[sec.Key("sso_session").String()] = true
+		}
+	}
+
+	for _, sec := range config.Sections() {
+		name, ok := cutPrefix(sec.Name(), "sso-session ")
+		if !ok || referenced[name] || !sec.HasKey("common_fate_generated_from") {
+			continue
+		}
 
+		startURL := sec.Key("sso_start_url").String()
+		for _, pruneURL := range pruneStartURLs {
+			if startURL == pruneURL {
+				config.DeleteSection(sec.Name())
+				break
+			}
+		}
 	}
+}
+
+// sectionStartURL returns the SSO start URL of a config section,
+// following the sso_session and source_profile keys if they are present.
+func sectionStartURL(config *ini.File, sec *ini.Section) string {
+	visited := map[string]bool{}
+
+	for sec != nil && !visited[sec.Name()] {
+		visited[sec.Name()] = true
+
+		if sec.HasKey("granted_sso_start_url") {
+			return sec.Key("granted_sso_start_url").String()
+		}
+		if sec.HasKey("sso_start_url") {
+			return sec.Key("sso_start_url").String()
+		}
+		if sec.HasKey("sso_session") {
+			session, err := config.GetSection("sso-session " + sec.Key("sso_session").String())
+			if err == nil {
+				return session.Key("sso_start_url").String()
+			}
+			return ""
+		}
+		if !sec.HasKey("source_profile") {
+			return ""
+		}
+
+		sec = profileSection(config, sec.Key("source_profile").String())
+	}
+
+	return ""
+}
 
+// profileSection returns the section for a profile name, or nil if it doesn't exist.
+// The default profile may be written as either [profile default] or [default].
+// If both exist, [profile default] is used.
+func profileSection(config *ini.File, profileName string) *ini.Section {
+	sec, err := config.GetSection("profile " + profileName)
+	if err == nil {
+		return sec
+	}
+	if profileName == "default" {
+		sec, err = config.GetSection("default")
+		if err == nil {
+			return sec
+		}
+	}
 	return nil
 }
 
+func isSSOSessionSection(sectionName string) bool {
+	return strings.HasPrefix(sectionName, "sso-session ")
+}
+
 type credentialProcessProfile struct {
 	SSOStartURL             string `ini:"granted_sso_start_url"`
 	SSORegion               string `ini:"granted_sso_region"`
@@ -152,6 +1158,21 @@ type credentialProcessProfile struct {
 	Region                  string `ini:"region,omitempty"`
 }
 
+type ssoSessionProfile struct {
+	SSOSession              string `ini:"sso_session"`
+	SSOAccountID            string `ini:"sso_account_id"`
+	CommonFateGeneratedFrom string `ini:"common_fate_generated_from"`
+	SSORoleName             string `ini:"sso_role_name"`
+	Region                  string `ini:"region,omitempty"`
+}
+
+type ssoSessionSection struct {
+	SSOStartURL             string `ini:"sso_start_url"`
+	SSORegion               string `ini:"sso_region"`
+	SSORegistrationScopes   string `ini:"sso_registration_scopes"`
+	CommonFateGeneratedFrom string `ini:"common_fate_generated_from"`
+}
+
 type regularProfile struct {
 	SSOStartURL             string `ini:"sso_start_url"`
 	SSORegion               string `ini:"sso_region"`
@@ -164,3 +1185,19 @@ type regularProfile struct {
 func normalizeAccountName(accountName string) string {
 	return strings.ReplaceAll(accountName, " ", "-")
 }
+
+// cutPrefix is strings.CutPrefix, which is unavailable in Go 1.19.
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// cutSuffix is strings.CutSuffix, which is unavailable in Go 1.19.
+func cutSuffix(s, suffix string) (string, bool) {
+	if !strings.HasSuffix(s, suffix) {
+		return s, false
+	}
+	return s[:len(s)-len(suffix)], true
+}
@@ -10,7 +10,7 @@ import (
 )
 
 func parseIni(t *testing.T, data string) *ini.File {
-	ini, err := ini.Load([]byte(data))
+	ini, err := ini.LoadSources(iniLoadOptions, []byte(data))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -213,6 +213,869 @@ granted_sso_role_name      = DevRoleOne
 common_fate_generated_from = aws-sso
 credential_process         = granted credential-process --profile account2/DevRoleOne
 region                     = us-west-2
+`,
+		},
+		{
+			name: "sso sessions",
+			args: MergeOpts{
+				Config:              parseIni(t, ""),
+				NoCredentialProcess: true,
+				SSOSessions:         true,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.awsapps.com/start",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "account1",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+					{
+						SSOStartURL:   "https://example.awsapps.com/start",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "210987654321",
+						AccountName:   "account2",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+						Region:        "us-west-2",
+					},
+				},
+			},
+			want: `
+[sso-session example]
+sso_start_url              = https://example.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_registration_scopes    = sso:account:access
+common_fate_generated_from = aws-sso
+
+[profile account1/DevRole]
+sso_session                = example
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+
+[profile account2/DevRole]
+sso_session                = example
+sso_account_id             = 210987654321
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+region                     = us-west-2
+`,
+		},
+		{
+			name: "sso sessions in multiple regions",
+			args: MergeOpts{
+				Config:              parseIni(t, ""),
+				NoCredentialProcess: true,
+				SSOSessions:         true,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.awsapps.com/start",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "account1",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+					{
+						SSOStartURL:   "https://example.awsapps.com/start",
+						SSORegion:     "us-east-1",
+						AccountID:     "210987654321",
+						AccountName:   "account2",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[sso-session example-ap-southeast-2]
+sso_start_url              = https://example.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_registration_scopes    = sso:account:access
+common_fate_generated_from = aws-sso
+
+[profile account1/DevRole]
+sso_session                = example-ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+
+[sso-session example-us-east-1]
+sso_start_url              = https://example.awsapps.com/start
+sso_region                 = us-east-1
+sso_registration_scopes    = sso:account:access
+common_fate_generated_from = aws-sso
+
+[profile account2/DevRole]
+sso_session                = example-us-east-1
+sso_account_id             = 210987654321
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+`,
+		},
+		{
+			name: "sso session name template and hand-written session",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[sso-session mycompany]
+sso_start_url = https://example.awsapps.com/start
+sso_region    = ap-southeast-2
+`),
+				NoCredentialProcess:    true,
+				SSOSessions:            true,
+				SSOSessionNameTemplate: "mycompany",
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.awsapps.com/start",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "account1",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[sso-session mycompany]
+sso_start_url = https://example.awsapps.com/start
+sso_region    = ap-southeast-2
+
+[profile account1/DevRole]
+sso_session                = mycompany
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+`,
+		},
+		{
+			name: "hand-written sso session with a different start url",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[sso-session example]
+sso_start_url = https://other.awsapps.com/start
+sso_region    = ap-southeast-2
+`),
+				NoCredentialProcess: true,
+				SSOSessions:         true,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.awsapps.com/start",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "account1",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[sso-session example]
+sso_start_url = https://other.awsapps.com/start
+sso_region    = ap-southeast-2
+`,
+			wantErr: true,
+		},
+		{
+			name: "sso sessions are ignored with credential process",
+			args: MergeOpts{
+				Config:      parseIni(t, ""),
+				SSOSessions: true,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.awsapps.com/start",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "account1",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile account1/DevRole]
+granted_sso_start_url      = https://example.awsapps.com/start
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 123456789012
+granted_sso_role_name      = DevRole
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile account1/DevRole
+`,
+		},
+		{
+			name: "pruning removes orphaned sso sessions",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[sso-session deleteme]
+sso_start_url              = https://deleteme.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_registration_scopes    = sso:account:access
+common_fate_generated_from = aws-sso
+
+[profile should_be_removed]
+sso_session                = deleteme
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+
+[sso-session handwritten]
+sso_start_url = https://deleteme.awsapps.com/start
+sso_region    = ap-southeast-2
+`),
+				NoCredentialProcess: true,
+				SSOSessions:         true,
+				PruneStartURLs:      []string{"https://deleteme.awsapps.com/start"},
+			},
+			want: `
+[sso-session handwritten]
+sso_start_url = https://deleteme.awsapps.com/start
+sso_region    = ap-southeast-2
+`,
+		},
+		{
+			name: "assume role profiles",
+			args: MergeOpts{
+				Config: parseIni(t, ""),
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.awsapps.com/start",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "tooling",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+				AssumeRoleProfiles: []AssumeRoleProfile{
+					{
+						AccountID:       "210987654321",
+						AccountName:     "workload",
+						RoleName:        "Deploy",
+						SourceProfile:   "tooling/DevRole",
+						ExternalID:      "abc",
+						RoleSessionName: "deploy",
+						DurationSeconds: 3600,
+						GeneratedFrom:   "aws-sso",
+					},
+					{
+						AccountName:   "workload",
+						RoleName:      "Admin",
+						RoleARN:       "arn:aws-us-gov:iam::210987654321:role/Admin",
+						SourceProfile: "tooling/DevRole",
+						MFASerial:     "arn:aws:iam::123456789012:mfa/user",
+						Region:        "us-gov-west-1",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile tooling/DevRole]
+granted_sso_start_url      = https://example.awsapps.com/start
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 123456789012
+granted_sso_role_name      = DevRole
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile tooling/DevRole
+
+[profile workload/Admin]
+role_arn                   = arn:aws-us-gov:iam::210987654321:role/Admin
+source_profile             = tooling/DevRole
+common_fate_generated_from = aws-sso
+mfa_serial                 = arn:aws:iam::123456789012:mfa/user
+region                     = us-gov-west-1
+
+[profile workload/Deploy]
+role_arn                   = arn:aws:iam::210987654321:role/Deploy
+source_profile             = tooling/DevRole
+common_fate_generated_from = aws-sso
+external_id                = abc
+role_session_name          = deploy
+duration_seconds           = 3600
+`,
+		},
+		{
+			name: "assume role profile with missing source profile",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[profile example]
+test = 1
+`),
+				AssumeRoleProfiles: []AssumeRoleProfile{
+					{
+						AccountID:     "210987654321",
+						AccountName:   "workload",
+						RoleName:      "Deploy",
+						SourceProfile: "missing",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile example]
+test = 1
+`,
+			wantErr: true,
+		},
+		{
+			name: "assume role profile with external or default source profile",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[default]
+region = us-east-1
+`),
+				ExternalSourceProfiles: []string{"from-credentials-file"},
+				AssumeRoleProfiles: []AssumeRoleProfile{
+					{
+						AccountID:     "210987654321",
+						AccountName:   "workload",
+						RoleName:      "Deploy",
+						SourceProfile: "default",
+						GeneratedFrom: "aws-sso",
+					},
+					{
+						AccountID:     "210987654321",
+						AccountName:   "workload",
+						RoleName:      "ReadOnly",
+						SourceProfile: "from-credentials-file",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[default]
+region = us-east-1
+
+[profile workload/Deploy]
+role_arn                   = arn:aws:iam::210987654321:role/Deploy
+source_profile             = default
+common_fate_generated_from = aws-sso
+
+[profile workload/ReadOnly]
+role_arn                   = arn:aws:iam::210987654321:role/ReadOnly
+source_profile             = from-credentials-file
+common_fate_generated_from = aws-sso
+`,
+		},
+		{
+			name: "pruning follows source profiles",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[profile hub]
+granted_sso_start_url      = https://deleteme.awsapps.com/start
+common_fate_generated_from = aws-sso
+
+[profile spoke]
+role_arn                   = arn:aws:iam::210987654321:role/Deploy
+source_profile             = hub
+common_fate_generated_from = aws-sso
+
+[profile handwritten-spoke]
+role_arn       = arn:aws:iam::210987654321:role/Deploy
+source_profile = hub
+
+[profile other-spoke]
+role_arn                   = arn:aws:iam::210987654321:role/Deploy
+source_profile             = other
+common_fate_generated_from = aws-sso
+
+[profile other]
+granted_sso_start_url      = https://other.awsapps.com/start
+common_fate_generated_from = aws-sso
+`),
+				PruneStartURLs: []string{"https://deleteme.awsapps.com/start"},
+			},
+			want: `
+[profile handwritten-spoke]
+role_arn       = arn:aws:iam::210987654321:role/Deploy
+source_profile = hub
+
+[profile other-spoke]
+role_arn                   = arn:aws:iam::210987654321:role/Deploy
+source_profile             = other
+common_fate_generated_from = aws-sso
+
+[profile other]
+granted_sso_start_url      = https://other.awsapps.com/start
+common_fate_generated_from = aws-sso
+`,
+		},
+		{
+			name: "extra keys",
+			args: MergeOpts{
+				Config:              parseIni(t, ""),
+				NoCredentialProcess: true,
+				ExtraKeys: []KeyValue{
+					{Key: "output", Value: "json"},
+					{Key: "cli_pager", Value: "cat"},
+					{Key: "granted_sso_session", Value: "{{ .AccountName | upper }}-{{ .RoleName }}"},
+				},
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+						ExtraKeys: []KeyValue{
+							{Key: "output", Value: "yaml"},
+							{Key: "duration_seconds", Value: "3600"},
+						},
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+output                     = yaml
+cli_pager                  = cat
+granted_sso_session        = TESTING-DevRole
+duration_seconds           = 3600
+`,
+		},
+		{
+			name: "extra keys must not replace generated keys",
+			args: MergeOpts{
+				Config: parseIni(t, ""),
+				ExtraKeys: []KeyValue{
+					{Key: "credential_process", Value: "something-else"},
+				},
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "extra keys must not contain multiple lines",
+			args: MergeOpts{
+				Config: parseIni(t, ""),
+				ExtraKeys: []KeyValue{
+					{Key: "s3", Value: "\n  max_concurrent_requests = 20"},
+				},
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "extra keys with nested values",
+			args: MergeOpts{
+				Config:              parseIni(t, ""),
+				NoCredentialProcess: true,
+				ExtraKeys: []KeyValue{
+					{Key: "s3", Nested: []string{"max_concurrent_requests = 20", "max_queue_size = {{ .AccountID | len }}"}},
+				},
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+s3                         = 
+  max_concurrent_requests = 20
+  max_queue_size = 12
+`,
+		},
+		{
+			name: "extra keys with nested values are updated",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[profile testing/DevRole]
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+s3                         =
+  max_concurrent_requests = 10
+`),
+				NoCredentialProcess: true,
+				ExtraKeys: []KeyValue{
+					{Key: "s3", Nested: []string{"max_concurrent_requests = 20"}},
+				},
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+s3                         = 
+  max_concurrent_requests = 20
+`,
+		},
+		{
+			name: "extra keys must not have both a value and nested values",
+			args: MergeOpts{
+				Config: parseIni(t, ""),
+				ExtraKeys: []KeyValue{
+					{Key: "s3", Value: "something", Nested: []string{"max_concurrent_requests = 20"}},
+				},
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "preserve merge policy keeps keys added by hand",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[profile testing/DevRole]
+; added by hand
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+; pinned to the old role
+sso_role_name              = OldRole
+region                     = us-east-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name,region
+`),
+				NoCredentialProcess: true,
+				MergePolicy:         MergePolicyPreserve,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+; added by hand
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+; pinned to the old role
+sso_role_name              = DevRole
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:3772e0c5
+`,
+		},
+		{
+			name: "preserve merge policy keeping existing values",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[profile testing/DevRole]
+; added by hand
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+; pinned to the old role
+sso_role_name              = OldRole
+region                     = us-east-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name,region
+`),
+				NoCredentialProcess: true,
+				MergePolicy:         MergePolicyPreserve,
+				KeyConflictStrategy: KeyConflictKeepExisting,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+; added by hand
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+; pinned to the old role
+sso_role_name              = OldRole
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031
+`,
+		},
+		{
+			name: "preserve merge policy with conflicts fails",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[profile testing/DevRole]
+; added by hand
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+; pinned to the old role
+sso_role_name              = OldRole
+region                     = us-east-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name,region
+`),
+				NoCredentialProcess: true,
+				MergePolicy:         MergePolicyPreserve,
+				KeyConflictStrategy: KeyConflictFail,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+; added by hand
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+; pinned to the old role
+sso_role_name              = OldRole
+region                     = us-east-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name,region
+`,
+			wantErr: true,
+		},
+		{
+			name: "preserve merge policy for new profiles",
+			args: MergeOpts{
+				Config:              parseIni(t, ""),
+				NoCredentialProcess: true,
+				MergePolicy:         MergePolicyPreserve,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:3772e0c5
+`,
+		},
+		{
+			name: "preserve merge policy updates keys changed by the generator",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[profile testing/DevRole]
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = OldRole
+region                     = us-east-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name,region
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:b3b64830,region:487d6534
+`),
+				NoCredentialProcess: true,
+				MergePolicy:         MergePolicyPreserve,
+				KeyConflictStrategy: KeyConflictFail,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:3772e0c5
+`,
+		},
+		{
+			name: "preserve merge policy keeping existing values updates keys changed by the generator",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[profile testing/DevRole]
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = OldRole
+region                     = us-east-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name,region
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:b3b64830,region:487d6534
+`),
+				NoCredentialProcess: true,
+				MergePolicy:         MergePolicyPreserve,
+				KeyConflictStrategy: KeyConflictKeepExisting,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:3772e0c5
+`,
+		},
+		{
+			name: "preserve merge policy with keys edited by hand fails",
+			args: MergeOpts{
+				Config: parseIni(t, `
+[profile testing/DevRole]
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = OldRole
+region                     = us-east-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name,region
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:3772e0c5,region:487d6534
+`),
+				NoCredentialProcess: true,
+				MergePolicy:         MergePolicyPreserve,
+				KeyConflictStrategy: KeyConflictFail,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+					},
+				},
+			},
+			want: `
+[profile testing/DevRole]
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = OldRole
+region                     = us-east-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name,region
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:3772e0c5,region:487d6534
+`,
+			wantErr: true,
+		},
+		{
+			name: "metadata in section name template",
+			args: MergeOpts{
+				Config:              parseIni(t, ``),
+				NoCredentialProcess: true,
+				SectionNameTemplate: `{{ .Tag "environment" }}/{{ .OU | base }}/{{ .AccountName }}/{{ .RoleName }}`,
+				Profiles: []SSOProfile{
+					{
+						SSOStartURL:   "https://example.com",
+						SSORegion:     "ap-southeast-2",
+						AccountID:     "123456789012",
+						AccountName:   "testing",
+						RoleName:      "DevRole",
+						GeneratedFrom: "aws-sso",
+						Metadata:      Metadata{MetadataOU: "Root/Workloads", "tag:environment": "dev"},
+					},
+				},
+			},
+			want: `
+[profile dev/Workloads/testing/DevRole]
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
 `,
 		},
 	}
@@ -236,3 +1099,134 @@ region                     = us-west-2
 		})
 	}
 }
+
+func TestMerge_PreserveKeepsEditedKeysWhichAreNoLongerGenerated(t *testing.T) {
+	cfg := parseIni(t, `
+[profile testing/DevRole]
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+region                     = eu-west-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:3772e0c5
+`)
+	profile := SSOProfile{
+		SSOStartURL:   "https://example.com",
+		SSORegion:     "ap-southeast-2",
+		AccountID:     "123456789012",
+		AccountName:   "testing",
+		RoleName:      "DevRole",
+		GeneratedFrom: "aws-sso",
+		Region:        "us-west-2",
+	}
+	opts := MergeOpts{
+		Config:              cfg,
+		NoCredentialProcess: true,
+		MergePolicy:         MergePolicyPreserve,
+		KeyConflictStrategy: KeyConflictKeepExisting,
+		Profiles:            []SSOProfile{profile},
+	}
+
+	// the region added by hand is kept over the generated region.
+	err := Merge(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "eu-west-1", cfg.Section("profile testing/DevRole").Key("region").String())
+
+	// the region is still kept once the generator stops writing it.
+	profile.Region = ""
+	opts.Profiles = []SSOProfile{profile}
+	err = Merge(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "eu-west-1", cfg.Section("profile testing/DevRole").Key("region").String())
+}
+
+func TestMerge_PreserveKeepsGeneratedKeysEditedByHand(t *testing.T) {
+	// region was generated as us-east-1 (hash 487d6534) and has since been edited by hand.
+	cfg := parseIni(t, `
+[profile testing/DevRole]
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+region                     = eu-west-1
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name,region
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:3772e0c5,region:487d6534
+`)
+	err := Merge(MergeOpts{
+		Config:              cfg,
+		NoCredentialProcess: true,
+		MergePolicy:         MergePolicyPreserve,
+		Profiles: []SSOProfile{
+			{
+				SSOStartURL:   "https://example.com",
+				SSORegion:     "ap-southeast-2",
+				AccountID:     "123456789012",
+				AccountName:   "testing",
+				RoleName:      "DevRole",
+				GeneratedFrom: "aws-sso",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "eu-west-1", cfg.Section("profile testing/DevRole").Key("region").String())
+}
+
+func TestMerge_PreserveMigratesUntrackedProfiles(t *testing.T) {
+	// generated with the credential process by the replace policy, so there are no tracking keys.
+	cfg := parseIni(t, `
+[profile testing/DevRole]
+granted_sso_start_url      = https://example.com
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 123456789012
+granted_sso_role_name      = DevRole
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile testing/DevRole
+; added by hand
+output                     = json
+`)
+	err := Merge(MergeOpts{
+		Config:              cfg,
+		NoCredentialProcess: true,
+		MergePolicy:         MergePolicyPreserve,
+		KeyConflictStrategy: KeyConflictKeepExisting,
+		Profiles: []SSOProfile{
+			{
+				SSOStartURL:   "https://example.com",
+				SSORegion:     "ap-southeast-2",
+				AccountID:     "123456789012",
+				AccountName:   "testing",
+				RoleName:      "DevRole",
+				GeneratedFrom: "aws-sso",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	_, err = cfg.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[profile testing/DevRole]
+common_fate_generated_from = aws-sso
+; added by hand
+output                     = json
+sso_start_url              = https://example.com
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+sso_role_name              = DevRole
+common_fate_generated_keys = sso_start_url,sso_region,sso_account_id,common_fate_generated_from,sso_role_name
+common_fate_value_hashes   = sso_start_url:100680ad,sso_region:d2add9c0,sso_account_id:2a33349e,common_fate_generated_from:ef700031,sso_role_name:3772e0c5`
+	assert.Equal(t, want, strings.TrimSpace(b.String()))
+}
@@ -0,0 +1,224 @@
+package awsconfigfile
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CachedSource caches the profiles returned by another Source in a directory,
+// so that slow or remote sources don't need to be called every time profiles are generated.
+//
+// Cached profiles are returned if they were loaded within TTL. Otherwise the source is called,
+// and if it fails the last cached profiles are returned instead, so that profiles can still be
+// generated when the machine is offline. CachedSource implements StaleSource, so Generator
+// reports the stale profiles in a *PartialFailureError, and OnStale is called if it is set.
+type CachedSource struct {
+	Source Source
+	// Dir is the directory to store cached profiles in.
+	// Defaults to 'awsconfigfile' in the user's cache directory.
+	Dir string
+	// TTL is how long cached profiles are used for before the source is called again.
+	// If zero, the source is always called and the cache is only used if it fails.
+	TTL time.Duration
+	// Key identifies the source in the cache.
+	// Defaults to the name of the source, if it implements NamedSource,
+	// but must be set if multiple sources of the same type without names are cached.
+	Key string
+	// OnStale is called when the source fails and cached profiles are returned instead.
+	// err is the error returned by the source and cachedAt is when the cached profiles were loaded.
+	OnStale func(err error, cachedAt time.Time)
+
+	mu sync.Mutex
+	// stale is set if the last profiles returned were cached because the source failed.
+	stale *StaleError
+	// pending is the snapshot loaded by GetProfiles for GetAssumeRoleProfiles to return,
+	// so that the source is only called once when both are loaded.
+	pending *cacheSnapshot
+	// now is used to override the time in tests.
+	now func() time.Time
+}
+
+// cacheVersion is incremented if the cache format changes,
+// so that incompatible snapshots are ignored.
+const cacheVersion = 1
+
+// cacheSnapshot is the profiles returned by a source at a point in time.
+type cacheSnapshot struct {
+	Version            int                 `json:"version"`
+	Source             string              `json:"source"`
+	CachedAt           time.Time           `json:"cached_at"`
+	Profiles           []SSOProfile        `json:"profiles"`
+	AssumeRoleProfiles []AssumeRoleProfile `json:"assume_role_profiles,omitempty"`
+}
+
+// Name implements NamedSource.
+func (s *CachedSource) Name() string {
+	return sourceName(s.Source)
+}
+
+// Unwrap returns the underlying source.
+func (s *CachedSource) Unwrap() Source {
+	return s.Source
+}
+
+// Stale implements StaleSource. It returns a *StaleError if the last profiles
+// returned were cached because the source failed, and nil otherwise.
+func (s *CachedSource) Stale() *StaleError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stale
+}
+
+// StaleError reports that a source failed and previously cached profiles were used instead.
+type StaleError struct {
+	// Source is the name of the source which failed.
+	Source string
+	Err    error
+	// CachedAt is when the cached profiles were loaded from the source.
+	CachedAt time.Time
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("using profiles from %s cached at %s: %s", e.Source, e.CachedAt.Format(time.RFC3339), e.Err)
+}
+
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+// GetProfiles implements Source.
+func (s *CachedSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.Source.(AssumeRoleSource); ok {
+		s.pending = snap
+	}
+	return snap.Profiles, nil
+}
+
+// GetAssumeRoleProfiles implements AssumeRoleSource.
+// It returns nil if the underlying source does not implement AssumeRoleSource.
+func (s *CachedSource) GetAssumeRoleProfiles(ctx context.Context) ([]AssumeRoleProfile, error) {
+	if _, ok := s.Source.(AssumeRoleSource); !ok {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := s.pending
+	s.pending = nil
+	if snap == nil {
+		var err error
+		snap, err = s.load(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return snap.AssumeRoleProfiles, nil
+}
+
+// load returns the cached snapshot if it is within the TTL,
+// and otherwise loads the source and updates the cache.
+func (s *CachedSource) load(ctx context.Context) (*cacheSnapshot, error) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+
+	path, err := s.path()
+	if err != nil {
+		return nil, err
+	}
+
+	s.stale = nil
+
+	cached := readCacheSnapshot(path)
+	if cached != nil && s.TTL > 0 && now().Sub(cached.CachedAt) < s.TTL {
+		return cached, nil
+	}
+
+	r, err := loadSource(ctx, s.Source)
+	if err != nil {
+		if cached == nil {
+			return nil, err
+		}
+		s.stale = &StaleError{Source: sourceName(s.Source), Err: err, CachedAt: cached.CachedAt}
+		if s.OnStale != nil {
+			s.OnStale(err, cached.CachedAt)
+		}
+		return cached, nil
+	}
+
+	snap := cacheSnapshot{
+		Version:            cacheVersion,
+		Source:             sourceName(s.Source),
+		CachedAt:           now().UTC(),
+		Profiles:           r.Profiles,
+		AssumeRoleProfiles: r.AssumeRoleProfiles,
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomic(path, data, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("writing profile cache: %w", err)
+	}
+
+	return &snap, nil
+}
+
+// path returns the path of the cache file, which is named with
+// the SHA256 hash of the cache key.
+func (s *CachedSource) path() (string, error) {
+	dir := s.Dir
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(cacheDir, "awsconfigfile")
+	}
+
+	key := s.Key
+	if key == "" {
+		key = sourceName(s.Source)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// readCacheSnapshot reads a cached snapshot.
+// It returns nil if the snapshot does not exist or can't be read,
+// in which case the source is called as if there was no cache.
+func readCacheSnapshot(path string) *cacheSnapshot {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var snap cacheSnapshot
+	err = json.Unmarshal(data, &snap)
+	if err != nil || snap.Version != cacheVersion {
+		return nil
+	}
+	return &snap
+}
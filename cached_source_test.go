@@ -0,0 +1,179 @@
+package awsconfigfile
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/ini.v1"
+)
+
+// countingSource counts the number of times it is loaded,
+// and fails if err is set.
+type countingSource struct {
+	testSource
+	calls int
+	err   error
+}
+
+func (s *countingSource) Name() string {
+	return "counting"
+}
+
+func (s *countingSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Profiles, nil
+}
+
+func TestCachedSource(t *testing.T) {
+	profile := SSOProfile{
+		SSOStartURL:   "https://example.awsapps.com/start",
+		SSORegion:     "us-east-1",
+		AccountID:     "123456789012",
+		AccountName:   "prod",
+		RoleName:      "DevRole",
+		GeneratedFrom: "aws-sso",
+	}
+	role := AssumeRoleProfile{AccountID: "210987654321", AccountName: "audit", RoleName: "Auditor", SourceProfile: "prod/DevRole"}
+
+	src := &countingSource{testSource: testSource{Profiles: []SSOProfile{profile}, AssumeRoleProfiles: []AssumeRoleProfile{role}}}
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	var staleErr error
+	var staleAt time.Time
+
+	cs := &CachedSource{
+		Source: src,
+		Dir:    t.TempDir(),
+		TTL:    time.Hour,
+		OnStale: func(err error, cachedAt time.Time) {
+			staleErr = err
+			staleAt = cachedAt
+		},
+		now: func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	// the first load calls the source once for both kinds of profile.
+	got, err := loadSource(ctx, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []SSOProfile{profile}, got.Profiles)
+	assert.Equal(t, []AssumeRoleProfile{role}, got.AssumeRoleProfiles)
+	assert.Equal(t, 1, src.calls)
+
+	// within the TTL the cache is used, even by a new CachedSource.
+	now = now.Add(30 * time.Minute)
+	cs2 := &CachedSource{Source: src, Dir: cs.Dir, TTL: time.Hour, now: cs.now}
+	got, err = loadSource(ctx, cs2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []SSOProfile{profile}, got.Profiles)
+	assert.Equal(t, []AssumeRoleProfile{role}, got.AssumeRoleProfiles)
+	assert.Equal(t, 1, src.calls)
+
+	// after the TTL the source is called, and the cached profiles are used if it fails.
+	now = now.Add(time.Hour)
+	src.err = errors.New("offline")
+	got, err = loadSource(ctx, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []SSOProfile{profile}, got.Profiles)
+	assert.Equal(t, 2, src.calls)
+	assert.EqualError(t, staleErr, "offline")
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), staleAt)
+	assert.Equal(t, &StaleError{Source: sourceName(src), Err: src.err, CachedAt: staleAt}, cs.Stale())
+
+	// the stale error is cleared once the source succeeds again.
+	src.err = nil
+	_, err = loadSource(ctx, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, cs.Stale())
+	src.err = errors.New("offline")
+
+	// without a cache, the error is returned.
+	empty := &CachedSource{Source: src, Dir: t.TempDir(), TTL: time.Hour}
+	_, err = empty.GetProfiles(ctx)
+	assert.EqualError(t, err, "offline")
+}
+
+func TestCachedSource_CorruptCache(t *testing.T) {
+	src := &countingSource{testSource: testSource{Profiles: []SSOProfile{{AccountID: "123456789012"}}}}
+	cs := &CachedSource{Source: src, Dir: t.TempDir(), TTL: time.Hour}
+
+	path, err := cs.path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte("not json"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := cs.GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, got, 1)
+	assert.Equal(t, 1, src.calls)
+}
+
+func TestCachedSource_Unwrap(t *testing.T) {
+	cs := &CachedSource{Source: startURLFailingSource{failingSource{startURLs: []string{"https://example.awsapps.com/start"}}}}
+
+	got, ok := sourceStartURLs(cs)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"https://example.awsapps.com/start"}, got)
+	assert.Equal(t, "failing", cs.Name())
+
+	_, ok = sourceStartURLs(&CachedSource{Source: failingSource{}})
+	assert.False(t, ok)
+}
+
+func TestGenerator_StaleCachedSource(t *testing.T) {
+	profile := SSOProfile{
+		SSOStartURL:   "https://example.awsapps.com/start",
+		SSORegion:     "us-east-1",
+		AccountID:     "123456789012",
+		AccountName:   "prod",
+		RoleName:      "DevRole",
+		GeneratedFrom: "aws-sso",
+	}
+	src := &countingSource{testSource: testSource{Profiles: []SSOProfile{profile}}}
+	cs := &CachedSource{Source: src, Dir: t.TempDir()}
+	ctx := context.Background()
+
+	_, err := loadSource(ctx, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stale profiles are merged and reported, even without ContinueOnSourceError.
+	src.err = errors.New("offline")
+	g := &Generator{
+		Sources:             []Source{Include(cs, func(SSOProfile) bool { return true })},
+		Config:              ini.Empty(),
+		NoCredentialProcess: true,
+		PruneStartURLs:      []string{"https://example.awsapps.com/start"},
+	}
+	err = g.Generate(ctx)
+
+	var partialErr *PartialFailureError
+	assert.True(t, errors.As(err, &partialErr), "expected a *PartialFailureError, got %v", err)
+	assert.Empty(t, partialErr.Errors)
+	assert.Len(t, partialErr.Stale, 1)
+	assert.True(t, partialErr.PruningSkipped)
+	assert.Contains(t, err.Error(), "1 of the sources used stale cached profiles")
+	assert.True(t, g.Config.HasSection("profile prod/DevRole"))
+}
@@ -0,0 +1,480 @@
+// Command awsconfigfile generates AWS profiles in ~/.aws/config.
+//
+// Usage:
+//
+//	awsconfigfile generate --config generator.yaml [flags]
+//	awsconfigfile diff --config generator.yaml [flags]
+//	awsconfigfile prune --config generator.yaml --prune-start-url URL [flags]
+//	awsconfigfile list [flags]
+//	awsconfigfile lint [flags]
+//	awsconfigfile switch-roles --config generator.yaml [flags]
+//
+// The config file is loaded with awsconfigfile.LoadGeneratorConfig,
+// and flags which are set override the values in it.
+//
+// 'diff' exits with status 1 if the config file is out of date, and 'lint' exits with
+// status 1 if the config file has errors, so that they can be used in CI.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/common-fate/awsconfigfile"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+const usage = `Usage: awsconfigfile <command> [flags]
+
+Commands:
+  generate  generate profiles and write them to the AWS config file
+  diff      show the changes that generate would make, exiting with status 1 if there are any
+  prune     remove generated profiles which the sources no longer return
+  list      list the generated profiles in the AWS config file
+  lint      check the AWS config file for problems, exiting with status 1 if there are errors
+  switch-roles
+            print the profiles as configuration for the AWS Extend Switch Roles browser extension
+
+Run 'awsconfigfile <command> -h' for the flags of each command.
+`
+
+// Exit codes. diff follows the convention of diff(1),
+// exiting with status 1 if there are changes and 2 if there is an error.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+
+	exitDiffChanges = 1
+	exitDiffError   = 2
+)
+
+// run runs the CLI and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "generate":
+		return runGenerate(ctx, args, stdout, stderr)
+	case "diff":
+		return runDiff(ctx, args, stdout, stderr)
+	case "prune":
+		return runPrune(ctx, args, stdout, stderr)
+	case "list":
+		return runList(args, stdout, stderr)
+	case "lint":
+		return runLint(args, stdout, stderr)
+	case "switch-roles":
+		return runSwitchRoles(ctx, args, stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+
+	fmt.Fprintf(stderr, "unknown command %q\n\n%s", cmd, usage)
+	return exitUsage
+}
+
+// stringsFlag is a flag which can be repeated.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// generatorFlags are the flags shared by the commands which load sources.
+type generatorFlags struct {
+	awsConfig           string
+	config              string
+	template            string
+	prefix              string
+	noCredentialProcess bool
+	pruneStartURLs      stringsFlag
+	continueOnError     bool
+	lint                bool
+	skipInvalid         bool
+
+	// set is the names of the flags which were set on the command line.
+	set map[string]bool
+}
+
+func (f *generatorFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.awsConfig, "aws-config", "", "the AWS config file to update (defaults to $AWS_CONFIG_FILE or ~/.aws/config)")
+	fs.StringVar(&f.config, "config", "", "the generator config file listing the sources to load profiles from (.yaml, .yml or .toml)")
+	fs.StringVar(&f.template, "template", awsconfigfile.DefaultProfileNameTemplate, "the template used to name profiles")
+	fs.StringVar(&f.prefix, "prefix", "", "a prefix added to the name of every profile")
+	fs.BoolVar(&f.noCredentialProcess, "no-credential-process", false, "write native AWS SSO profiles rather than using the Granted credential process")
+	fs.Var(&f.pruneStartURLs, "prune-start-url", "remove generated profiles for this SSO start URL which are no longer returned by the sources (can be repeated)")
+	fs.BoolVar(&f.continueOnError, "continue-on-error", false, "merge the profiles from the sources which succeed if any sources fail")
+	fs.BoolVar(&f.skipInvalid, "skip-invalid", false, "validate profiles and skip the invalid ones, rather than writing them")
+	fs.BoolVar(&f.lint, "lint", false, "check the AWS config file for errors after merging and before writing it")
+}
+
+// generator loads the AWS config file and generator config file and returns a generator for them.
+func (f *generatorFlags) generator() (*awsconfigfile.ConfigFile, *awsconfigfile.Generator, error) {
+	if f.config == "" {
+		return nil, nil, errors.New("--config is required")
+	}
+	g, err := awsconfigfile.LoadGeneratorConfig(f.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if f.set["template"] {
+		g.ProfileNameTemplate = f.template
+	}
+	if f.set["prefix"] {
+		g.Prefix = f.prefix
+	}
+	if f.set["no-credential-process"] {
+		g.NoCredentialProcess = f.noCredentialProcess
+	}
+	if f.set["prune-start-url"] {
+		g.PruneStartURLs = f.pruneStartURLs
+	}
+	if f.set["continue-on-error"] {
+		g.ContinueOnSourceError = f.continueOnError
+	}
+	if f.set["lint"] {
+		g.Lint = f.lint
+	}
+	if f.skipInvalid {
+		g.Validation = awsconfigfile.ValidationSkip
+	}
+	if g.SSOSessions && !g.NoCredentialProcess {
+		return nil, nil, errors.New("sso_sessions requires --no-credential-process or no_credential_process in the config file")
+	}
+
+	cfg, err := awsconfigfile.LoadConfig(f.awsConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	g.Config = cfg.File
+	return cfg, g, nil
+}
+
+// parseFlags parses the flags for a command, returning false if the command should exit.
+func parseFlags(fs *flag.FlagSet, args []string) (exitCode int, ok bool) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK, false
+	}
+	if err != nil {
+		return exitUsage, false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// setFlags returns the names of the flags which were set on the command line.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// reportSkipped prints the invalid profiles which were skipped
+// and the profile name collisions which were resolved.
+func reportSkipped(cs *awsconfigfile.ChangeSet, stderr io.Writer) {
+	for _, p := range cs.Skipped {
+		fmt.Fprintf(stderr, "warning: skipped %s\n", p)
+	}
+	for _, c := range cs.Collisions {
+		fmt.Fprintf(stderr, "warning: %s\n", c)
+	}
+}
+
+// reportPartialFailure prints the sources which failed, the invalid profiles which were skipped
+// and the profile name collisions if err is a *PartialFailureError, and returns false for any other error.
+func reportPartialFailure(err error, stderr io.Writer) bool {
+	var pfe *awsconfigfile.PartialFailureError
+	if !errors.As(err, &pfe) {
+		return false
+	}
+	for _, e := range pfe.Errors {
+		fmt.Fprintf(stderr, "warning: %s\n", e)
+	}
+	for _, e := range pfe.Stale {
+		fmt.Fprintf(stderr, "warning: %s\n", e)
+	}
+	for _, p := range pfe.Skipped {
+		fmt.Fprintf(stderr, "warning: skipped %s\n", p)
+	}
+	for _, c := range pfe.Collisions {
+		fmt.Fprintf(stderr, "warning: %s\n", c)
+	}
+	return true
+}
+
+func runGenerate(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var f generatorFlags
+	f.register(fs)
+	backups := fs.Int("backups", 0, "the number of backups of the AWS config file to keep")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	f.set = setFlags(fs)
+
+	cfg, g, err := f.generator()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	var before bytes.Buffer
+	_, err = cfg.WriteTo(&before)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	err = g.Generate(ctx)
+	if err != nil && !reportPartialFailure(err, stderr) {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	// the config isn't saved if it hasn't changed, so that backups aren't rotated.
+	var after bytes.Buffer
+	_, err = cfg.WriteTo(&after)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if bytes.Equal(before.Bytes(), after.Bytes()) {
+		fmt.Fprintf(stdout, "%s is up to date\n", cfg.Path)
+		return exitOK
+	}
+
+	err = awsconfigfile.SaveConfig(cfg, awsconfigfile.SaveOpts{Backups: *backups})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	fmt.Fprintf(stdout, "updated %s\n", cfg.Path)
+	return exitOK
+}
+
+func runDiff(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var f generatorFlags
+	f.register(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	f.set = setFlags(fs)
+
+	cfg, g, err := f.generator()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitDiffError
+	}
+
+	cs, err := g.Plan(ctx)
+	if err != nil && (cs == nil || !reportPartialFailure(err, stderr)) {
+		fmt.Fprintln(stderr, err)
+		return exitDiffError
+	}
+	reportSkipped(cs, stderr)
+
+	err = cs.WriteUnifiedDiff(stdout, cfg.Path, cfg.Path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitDiffError
+	}
+	if cs.HasChanges() {
+		return exitDiffChanges
+	}
+	return exitOK
+}
+
+func runPrune(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var f generatorFlags
+	f.register(fs)
+	dryRun := fs.Bool("dry-run", false, "print the profiles which would be removed without removing them")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	f.set = setFlags(fs)
+
+	cfg, g, err := f.generator()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if len(g.PruneStartURLs) == 0 {
+		fmt.Fprintln(stderr, "at least one --prune-start-url or prune_start_urls in the config file is required")
+		return exitUsage
+	}
+
+	cs, err := g.Plan(ctx)
+	if err != nil && (cs == nil || !reportPartialFailure(err, stderr)) {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	if *dryRun {
+		for _, sec := range cs.Removed {
+			fmt.Fprintf(stdout, "would remove [%s]\n", sec.Name)
+		}
+		return exitOK
+	}
+
+	// only the removed sections are applied, so that profiles are not added or updated.
+	for _, sec := range cs.Removed {
+		fmt.Fprintf(stdout, "removing [%s]\n", sec.Name)
+		cfg.DeleteSection(sec.Name)
+	}
+	if len(cs.Removed) == 0 {
+		return exitOK
+	}
+
+	err = awsconfigfile.SaveConfig(cfg, awsconfigfile.SaveOpts{})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+func runList(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	awsConfig := fs.String("aws-config", "", "the AWS config file to read (defaults to $AWS_CONFIG_FILE or ~/.aws/config)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	cfg, err := awsconfigfile.LoadConfig(*awsConfig)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	groups := map[string][]string{}
+	for _, sec := range cfg.Sections() {
+		name := sec.Name()
+		if !strings.HasPrefix(name, "profile ") && name != "default" {
+			continue
+		}
+		if !sec.HasKey("common_fate_generated_from") {
+			continue
+		}
+		name = strings.TrimPrefix(name, "profile ")
+		from := sec.Key("common_fate_generated_from").String()
+		groups[from] = append(groups[from], name)
+	}
+
+	var sources []string
+	for s := range groups {
+		sources = append(sources, s)
+	}
+	sort.Strings(sources)
+
+	for _, s := range sources {
+		fmt.Fprintf(stdout, "%s:\n", s)
+		for _, name := range groups[s] {
+			fmt.Fprintf(stdout, "  %s\n", name)
+		}
+	}
+	return exitOK
+}
+
+func runLint(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	awsConfig := fs.String("aws-config", "", "the AWS config file to check (defaults to $AWS_CONFIG_FILE or ~/.aws/config)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	cfg, err := awsconfigfile.LoadConfig(*awsConfig)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	code := exitOK
+	for _, f := range awsconfigfile.Lint(cfg.File) {
+		fmt.Fprintln(stdout, f)
+		if f.Severity == awsconfigfile.SeverityError {
+			code = exitError
+		}
+	}
+	return code
+}
+
+func runSwitchRoles(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("switch-roles", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var f generatorFlags
+	f.register(fs)
+	var sr awsconfigfile.SwitchRolesOpts
+	var colors stringsFlag
+	fs.StringVar(&sr.RoleARNTemplate, "role-arn-template", "", "the template used to build the role ARN of each profile")
+	fs.StringVar(&sr.ColorTag, "color-tag", "", "the account tag used to choose the color of each profile, such as 'environment'")
+	fs.Var(&colors, "color", "the color for a value of --color-tag, such as 'production=ff0000' (can be repeated)")
+	fs.StringVar(&sr.DefaultColor, "default-color", "", "the color of profiles without a --color for their tag value")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	f.set = setFlags(fs)
+
+	for _, c := range colors {
+		value, color, ok := strings.Cut(c, "=")
+		if !ok {
+			fmt.Fprintf(stderr, "invalid --color %q, expected VALUE=COLOR\n", c)
+			return exitUsage
+		}
+		if sr.Colors == nil {
+			sr.Colors = map[string]string{}
+		}
+		sr.Colors[value] = color
+	}
+
+	_, g, err := f.generator()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	err = g.ExportSwitchRoles(ctx, stdout, sr)
+	if err != nil && !reportPartialFailure(err, stderr) {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
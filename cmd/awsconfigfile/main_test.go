@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runCLI(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(context.Background(), args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	awsConfig := filepath.Join(dir, "config")
+	profiles := filepath.Join(dir, "profiles.yaml")
+	generator := filepath.Join(dir, "generator.yaml")
+
+	writeFile(t, awsConfig, `[profile example]
+region = us-east-1
+`)
+	writeFile(t, profiles, `
+sso_start_url: https://example.awsapps.com/start
+sso_region: us-east-1
+profiles:
+  - {account_id: "111111111111", account_name: prod, role_name: Admin}
+  - {account_id: "222222222222", account_name: dev, role_name: Admin}
+`)
+	writeFile(t, generator, `
+no_credential_process: true
+prune_start_urls: [https://example.awsapps.com/start]
+sources:
+  - type: file
+    paths: [profiles.yaml]
+`)
+
+	flags := []string{"--aws-config", awsConfig, "--config", generator}
+
+	// the config is out of date before generating
+	code, stdout, stderr := runCLI(t, append([]string{"diff"}, flags...)...)
+	assert.Equal(t, 1, code, stderr)
+	assert.Contains(t, stdout, "+[profile prod/Admin]")
+
+	code, _, stderr = runCLI(t, append([]string{"generate"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+
+	code, stdout, stderr = runCLI(t, append([]string{"diff"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+	assert.Empty(t, stdout)
+
+	// generating again doesn't save the config or write a backup.
+	code, stdout, stderr = runCLI(t, append([]string{"generate", "--backups", "1"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, awsConfig+" is up to date\n", stdout)
+	backups, err := filepath.Glob(awsConfig + ".*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, backups)
+
+	code, stdout, _ = runCLI(t, "list", "--aws-config", awsConfig)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "file:\n  dev/Admin\n  prod/Admin\n", stdout)
+
+	code, stdout, _ = runCLI(t, "lint", "--aws-config", awsConfig)
+	assert.Equal(t, 0, code)
+	assert.Empty(t, stdout)
+
+	code, stdout, stderr = runCLI(t, append([]string{"switch-roles", "--default-color", "00ff00"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, `; file
+[profile dev/Admin]
+role_arn = arn:aws:iam::222222222222:role/Admin
+color = 00ff00
+
+[profile prod/Admin]
+role_arn = arn:aws:iam::111111111111:role/Admin
+color = 00ff00
+`, stdout)
+
+	// prune removes profiles which are no longer returned, without adding new ones.
+	writeFile(t, profiles, `
+sso_start_url: https://example.awsapps.com/start
+sso_region: us-east-1
+profiles:
+  - {account_id: "111111111111", account_name: prod, role_name: Admin}
+  - {account_id: "333333333333", account_name: new, role_name: Admin}
+`)
+	code, stdout, stderr = runCLI(t, append([]string{"prune", "--dry-run"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "would remove [profile dev/Admin]\n", stdout)
+
+	code, stdout, _ = runCLI(t, "list", "--aws-config", awsConfig)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "file:\n  dev/Admin\n  prod/Admin\n", stdout)
+
+	code, stdout, stderr = runCLI(t, append([]string{"prune"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "removing [profile dev/Admin]\n", stdout)
+
+	code, stdout, _ = runCLI(t, "list", "--aws-config", awsConfig)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "file:\n  prod/Admin\n", stdout)
+
+	got, err := os.ReadFile(awsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(got), "[profile example]\nregion = us-east-1\n")
+}
+
+func TestRun_Errors(t *testing.T) {
+	generator := filepath.Join(t.TempDir(), "generator.yaml")
+	writeFile(t, generator, "sources: []\n")
+	sessions := filepath.Join(t.TempDir(), "sessions.yaml")
+	writeFile(t, sessions, "sso_sessions: true\nno_credential_process: true\nsources: []\n")
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "no command", wantCode: 2, wantErr: "Usage: awsconfigfile"},
+		{name: "unknown command", args: []string{"sync"}, wantCode: 2, wantErr: `unknown command "sync"`},
+		{name: "unknown flag", args: []string{"generate", "--nope"}, wantCode: 2, wantErr: "flag provided but not defined: -nope"},
+		{name: "missing config", args: []string{"generate"}, wantCode: 1, wantErr: "--config is required"},
+		{name: "diff error", args: []string{"diff"}, wantCode: 2, wantErr: "--config is required"},
+		{name: "invalid config", args: []string{"generate", "--config", "generator.json"}, wantCode: 1, wantErr: "generator.json"},
+		{name: "invalid color", args: []string{"switch-roles", "--color", "red"}, wantCode: 2, wantErr: `invalid --color "red", expected VALUE=COLOR`},
+		{name: "sso sessions with credential process", args: []string{"generate", "--config", sessions, "--no-credential-process=false"}, wantCode: 1, wantErr: "sso_sessions requires --no-credential-process"},
+		{name: "prune without start URL", args: []string{"prune", "--config", generator, "--aws-config", filepath.Join(t.TempDir(), "config")}, wantCode: 2, wantErr: "at least one --prune-start-url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runCLI(t, tt.args...)
+			assert.Equal(t, tt.wantCode, code)
+			assert.Contains(t, stderr, tt.wantErr)
+		})
+	}
+}
+
+func TestRun_Lint(t *testing.T) {
+	awsConfig := filepath.Join(t.TempDir(), "config")
+	writeFile(t, awsConfig, `[profile a]
+region = xx-north-9
+
+[profile b]
+role_arn       = arn:aws:iam::123456789012:role/B
+source_profile = b
+`)
+
+	code, stdout, _ := runCLI(t, "lint", "--aws-config", awsConfig)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, `warning: [profile a] region: "xx-north-9" is not a known region
+error: [profile b] source_profile: profile uses itself as its source_profile, but has no aws_access_key_id
+`, stdout)
+}
+
+func TestRun_StaleCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	awsConfig := filepath.Join(dir, "config")
+	profiles := filepath.Join(dir, "profiles.yaml")
+	generator := filepath.Join(dir, "generator.yaml")
+
+	writeFile(t, profiles, `
+sso_start_url: https://example.awsapps.com/start
+sso_region: us-east-1
+profiles:
+  - {account_id: "111111111111", account_name: prod, role_name: Admin}
+`)
+	// the cache expires immediately, so the source is always called.
+	writeFile(t, generator, `
+no_credential_process: true
+sources:
+  - type: file
+    paths: [profiles.yaml]
+    cache_ttl: 1ns
+`)
+	flags := []string{"--aws-config", awsConfig, "--config", generator}
+
+	code, _, stderr := runCLI(t, append([]string{"generate"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+	assert.Empty(t, stderr)
+
+	// once the source fails, the cached profiles are used with a warning.
+	err := os.Remove(profiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, stderr := runCLI(t, append([]string{"diff"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "warning: using profiles from file:")
+}
+
+func TestRun_SkipInvalid(t *testing.T) {
+	dir := t.TempDir()
+	awsConfig := filepath.Join(dir, "config")
+	profiles := filepath.Join(dir, "profiles.yaml")
+	generator := filepath.Join(dir, "generator.yaml")
+
+	writeFile(t, profiles, `
+sso_start_url: https://example.awsapps.com/start
+sso_region: us-east-1
+profiles:
+  - {account_id: "111111111111", account_name: prod, role_name: Admin}
+  - {account_id: "12345", account_name: broken, role_name: Admin}
+`)
+	writeFile(t, generator, `
+no_credential_process: true
+sources:
+  - type: file
+    paths: [profiles.yaml]
+`)
+
+	code, _, stderr := runCLI(t, "generate", "--skip-invalid", "--aws-config", awsConfig, "--config", generator)
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stderr, `warning: skipped file:`)
+	assert.Contains(t, stderr, `profile for account "12345" and role "Admin": account ID "12345" must be 12 digits`)
+
+	code, stdout, _ := runCLI(t, "list", "--aws-config", awsConfig)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "file:\n  prod/Admin\n", stdout)
+}
+
+func TestRun_Collisions(t *testing.T) {
+	dir := t.TempDir()
+	awsConfig := filepath.Join(dir, "config")
+	profiles := filepath.Join(dir, "profiles.yaml")
+	generator := filepath.Join(dir, "generator.yaml")
+
+	writeFile(t, profiles, `
+sso_start_url: https://example.awsapps.com/start
+sso_region: us-east-1
+profiles:
+  - {account_id: "111111111111", account_name: good, role_name: Dev}
+  - {account_id: "222222222222", account_name: good, role_name: Dev}
+`)
+	writeFile(t, generator, `
+no_credential_process: true
+collision_strategy: first-wins
+sources:
+  - type: file
+    paths: [profiles.yaml]
+`)
+	flags := []string{"--aws-config", awsConfig, "--config", generator}
+	want := "warning: profile good/Dev: role Dev in account good (222222222222) from file collides with role Dev in account good (111111111111) from file\n"
+
+	code, stdout, stderr := runCLI(t, append([]string{"diff"}, flags...)...)
+	assert.Equal(t, 1, code, stderr)
+	assert.Contains(t, stdout, "+[profile good/Dev]")
+	assert.Equal(t, want, stderr)
+
+	code, _, stderr = runCLI(t, append([]string{"generate"}, flags...)...)
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, want, stderr)
+}
@@ -0,0 +1,166 @@
+package awsconfigfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// CollisionStrategy controls how Merge handles profiles with the same name.
+type CollisionStrategy string
+
+const (
+	// CollisionFail causes Merge to return a *CollisionError
+	// without modifying the config file.
+	CollisionFail CollisionStrategy = "error"
+	// CollisionFirstWins keeps the first profile with a name and skips the others.
+	// Profiles are considered in the order they are given to Merge, with SSO profiles
+	// before assume role profiles, so profiles from sources added to a Generator first win.
+	// Profiles written by hand always win over generated profiles.
+	CollisionFirstWins CollisionStrategy = "first-wins"
+	// CollisionSuffixAccountID renames colliding profiles by appending
+	// the account ID, such as 'prod/DevRole-123456789012'.
+	CollisionSuffixAccountID CollisionStrategy = "suffix-account-id"
+	// CollisionSuffixCounter renames colliding profiles by appending
+	// a counter, such as 'prod/DevRole-2'.
+	CollisionSuffixCounter CollisionStrategy = "suffix-counter"
+)
+
+// Collision is a generated profile whose name was already in use.
+type Collision struct {
+	ProfileName string
+	// Profile is the SSOProfile or AssumeRoleProfile which collided.
+	Profile any
+	// Existing is the SSOProfile or AssumeRoleProfile which was already using ProfileName.
+	// It is nil if ProfileName is used by a profile written by hand.
+	Existing any
+	// RenamedTo is the new name of Profile if it was renamed.
+	// It is empty if Profile was skipped.
+	RenamedTo string
+}
+
+func (c Collision) String() string {
+	existing := "a profile written by hand"
+	if c.Existing != nil {
+		existing = describeProfile(c.Existing)
+	}
+	msg := fmt.Sprintf("profile %s: %s collides with %s", c.ProfileName, describeProfile(c.Profile), existing)
+	if c.RenamedTo != "" {
+		msg += ", renamed to " + c.RenamedTo
+	}
+	return msg
+}
+
+// CollisionError is returned by Merge if profiles have the same name
+// and CollisionStrategy is CollisionFail.
+type CollisionError struct {
+	Collisions []Collision
+}
+
+func (e *CollisionError) Error() string {
+	var msgs []string
+	for _, c := range e.Collisions {
+		msgs = append(msgs, c.String())
+	}
+	return "profile names collide: " + strings.Join(msgs, "; ")
+}
+
+// resolveCollisions checks for entries with the same profile name as each other,
+// or as an existing profile written by hand, and resolves them using the strategy.
+func resolveCollisions(config *ini.File, entries []profileEntry, strategy CollisionStrategy) ([]profileEntry, []Collision, error) {
+	var resolved []profileEntry
+	var collisions []Collision
+
+	// used maps the profile names which have been taken to the entry which took them.
+	// Profiles written by hand are mapped to nil.
+	used := map[string]any{}
+	for _, sec := range config.Sections() {
+		if sec.HasKey("common_fate_generated_from") {
+			continue
+		}
+		if name, ok := cutPrefix(sec.Name(), "profile "); ok {
+			used[name] = nil
+		}
+		// the default profile may be written as [default] rather than [profile default]
+		if sec.Name() == "default" {
+			used["default"] = nil
+		}
+	}
+
+	isUsed := func(name string) bool {
+		_, ok := used[name]
+		return ok
+	}
+
+	for _, entry := range entries {
+		if !isUsed(entry.ProfileName) {
+			used[entry.ProfileName] = entry.Profile
+			resolved = append(resolved, entry)
+			continue
+		}
+
+		collision := Collision{
+			ProfileName: entry.ProfileName,
+			Profile:     entry.Profile,
+			Existing:    used[entry.ProfileName],
+		}
+
+		switch strategy {
+		case CollisionFirstWins:
+			collisions = append(collisions, collision)
+			continue
+
+		case CollisionSuffixAccountID:
+			collision.RenamedTo = entry.ProfileName + "-" + profileAccountID(entry.Profile)
+
+		case CollisionSuffixCounter:
+			collision.RenamedTo = entry.ProfileName
+		}
+
+		if collision.RenamedTo == "" {
+			collisions = append(collisions, collision)
+			continue
+		}
+
+		// add a counter if the renamed profile still collides
+		base := collision.RenamedTo
+		for i := 2; isUsed(collision.RenamedTo); i++ {
+			collision.RenamedTo = base + "-" + strconv.Itoa(i)
+		}
+
+		collisions = append(collisions, collision)
+		entry.ProfileName = collision.RenamedTo
+		used[entry.ProfileName] = entry.Profile
+		resolved = append(resolved, entry)
+	}
+
+	if strategy == CollisionFail && len(collisions) > 0 {
+		return nil, nil, &CollisionError{Collisions: collisions}
+	}
+
+	return resolved, collisions, nil
+}
+
+// profileAccountID returns the account ID of an SSOProfile or AssumeRoleProfile.
+func profileAccountID(profile any) string {
+	switch p := profile.(type) {
+	case SSOProfile:
+		return p.AccountID
+	case AssumeRoleProfile:
+		return p.AccountID
+	}
+	return ""
+}
+
+// describeProfile returns a description of an SSOProfile or AssumeRoleProfile for error messages.
+func describeProfile(profile any) string {
+	switch p := profile.(type) {
+	case SSOProfile:
+		return fmt.Sprintf("role %s in account %s (%s) from %s", p.RoleName, p.AccountName, p.AccountID, p.GeneratedFrom)
+	case AssumeRoleProfile:
+		return fmt.Sprintf("assume role %s in account %s (%s) from %s", p.RoleName, p.AccountName, p.AccountID, p.GeneratedFrom)
+	}
+	return fmt.Sprintf("%v", profile)
+}
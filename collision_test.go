@@ -0,0 +1,277 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge_Collisions(t *testing.T) {
+	profiles := []SSOProfile{
+		{
+			SSOStartURL:   "https://org1.awsapps.com/start",
+			SSORegion:     "ap-southeast-2",
+			AccountID:     "111111111111",
+			AccountName:   "prod",
+			RoleName:      "DevRole",
+			GeneratedFrom: "aws-sso",
+		},
+		{
+			SSOStartURL:   "https://org2.awsapps.com/start",
+			SSORegion:     "ap-southeast-2",
+			AccountID:     "222222222222",
+			AccountName:   "prod",
+			RoleName:      "DevRole",
+			GeneratedFrom: "aws-sso",
+		},
+	}
+
+	tests := []struct {
+		name           string
+		config         string
+		strategy       CollisionStrategy
+		want           string
+		wantCollisions int
+		wantErr        bool
+	}{
+		{
+			name:           "error by default",
+			wantCollisions: 1,
+			wantErr:        true,
+		},
+		{
+			name:           "first wins",
+			strategy:       CollisionFirstWins,
+			wantCollisions: 1,
+			want: `
+[profile prod/DevRole]
+sso_start_url              = https://org1.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 111111111111
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+`,
+		},
+		{
+			name:           "suffix with account id",
+			strategy:       CollisionSuffixAccountID,
+			wantCollisions: 1,
+			want: `
+[profile prod/DevRole]
+sso_start_url              = https://org1.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 111111111111
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+
+[profile prod/DevRole-222222222222]
+sso_start_url              = https://org2.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 222222222222
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+`,
+		},
+		{
+			name:           "suffix with counter",
+			strategy:       CollisionSuffixCounter,
+			wantCollisions: 1,
+			want: `
+[profile prod/DevRole]
+sso_start_url              = https://org1.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 111111111111
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+
+[profile prod/DevRole-2]
+sso_start_url              = https://org2.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 222222222222
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+`,
+		},
+		{
+			name: "hand-written profiles win",
+			config: `
+[profile prod/DevRole]
+region = us-east-1
+
+[profile prod/DevRole-2]
+region = us-east-1
+`,
+			strategy:       CollisionSuffixCounter,
+			wantCollisions: 2,
+			want: `
+[profile prod/DevRole]
+region = us-east-1
+
+[profile prod/DevRole-2]
+region = us-east-1
+
+[profile prod/DevRole-3]
+sso_start_url              = https://org1.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 111111111111
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+
+[profile prod/DevRole-4]
+sso_start_url              = https://org2.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 222222222222
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+`,
+		},
+		{
+			name: "previously generated profiles are not collisions",
+			config: `
+[profile prod/DevRole]
+sso_start_url              = https://org1.awsapps.com/start
+common_fate_generated_from = aws-sso
+`,
+			strategy: CollisionFirstWins,
+			// the second profile collides with the first, but not the existing section
+			wantCollisions: 1,
+			want: `
+[profile prod/DevRole]
+sso_start_url              = https://org1.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 111111111111
+common_fate_generated_from = aws-sso
+sso_role_name              = DevRole
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := parseIni(t, tt.config)
+			opts := MergeOpts{
+				Config:              cfg,
+				NoCredentialProcess: true,
+				CollisionStrategy:   tt.strategy,
+				Profiles:            append([]SSOProfile{}, profiles...),
+			}
+
+			cs, err := Plan(opts)
+			if tt.wantErr {
+				var collisionErr *CollisionError
+				assert.True(t, errors.As(err, &collisionErr), "expected a *CollisionError, got %v", err)
+				if collisionErr != nil {
+					assert.Len(t, collisionErr.Collisions, tt.wantCollisions)
+					assert.Contains(t, collisionErr.Error(), "role DevRole in account prod (222222222222) from aws-sso collides with role DevRole in account prod (111111111111) from aws-sso")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Len(t, cs.Collisions, tt.wantCollisions)
+
+			// resolved collisions are reported after merging.
+			err = Merge(opts)
+			var partialErr *PartialFailureError
+			if assert.True(t, errors.As(err, &partialErr), err) {
+				assert.Equal(t, cs.Collisions, partialErr.Collisions)
+			}
+
+			var b bytes.Buffer
+			_, err = cfg.WriteTo(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, strings.TrimSpace(tt.want), strings.TrimSpace(b.String()))
+		})
+	}
+}
+
+func TestGenerator_CollisionsInSourceOrder(t *testing.T) {
+	// the first source's profile sorts after the second source's profile.
+	first := testSource{Profiles: []SSOProfile{
+		{
+			SSOStartURL:   "https://example.awsapps.com/start",
+			SSORegion:     "ap-southeast-2",
+			AccountID:     "111111111111",
+			AccountName:   "zeta",
+			RoleName:      "Admin",
+			GeneratedFrom: "aws-sso",
+		},
+	}}
+	second := testSource{Profiles: []SSOProfile{
+		{
+			SSOStartURL:   "https://example.awsapps.com/start",
+			SSORegion:     "ap-southeast-2",
+			AccountID:     "222222222222",
+			AccountName:   "alpha",
+			RoleName:      "Admin",
+			GeneratedFrom: "aws-sso",
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		strategy CollisionStrategy
+		want     string
+	}{
+		{
+			name:     "first wins",
+			strategy: CollisionFirstWins,
+			want: `
+[profile Admin]
+sso_start_url              = https://example.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 111111111111
+common_fate_generated_from = aws-sso
+sso_role_name              = Admin
+`,
+		},
+		{
+			name:     "suffix counter",
+			strategy: CollisionSuffixCounter,
+			want: `
+[profile Admin-2]
+sso_start_url              = https://example.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 222222222222
+common_fate_generated_from = aws-sso
+sso_role_name              = Admin
+
+[profile Admin]
+sso_start_url              = https://example.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 111111111111
+common_fate_generated_from = aws-sso
+sso_role_name              = Admin
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Generator{
+				Sources:             []Source{first, second},
+				Config:              parseIni(t, ""),
+				NoCredentialProcess: true,
+				ProfileNameTemplate: "{{ .RoleName }}",
+				CollisionStrategy:   tt.strategy,
+			}
+			err := g.Generate(context.Background())
+			var partialErr *PartialFailureError
+			if assert.True(t, errors.As(err, &partialErr), err) && assert.Len(t, partialErr.Collisions, 1) {
+				assert.Equal(t, "222222222222", profileAccountID(partialErr.Collisions[0].Profile))
+			}
+
+			var b bytes.Buffer
+			_, err = g.Config.WriteTo(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, strings.TrimSpace(tt.want), strings.TrimSpace(b.String()))
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// CommonFateSource loads a profile for every AWS account and role
+// that the user is entitled to access through Common Fate access rules.
+//
+// The generated profiles have CommonFateURL set, so that access is requested
+// through Common Fate by the Granted credential process.
+type CommonFateSource struct {
+	// URL is the Common Fate deployment URL, such as 'https://commonfate.example.com'.
+	URL string
+	// Token returns the bearer token used to call the Common Fate API.
+	Token func(ctx context.Context) (string, error)
+
+	// SSOStartURL and SSORegion are the IAM Identity Center instance
+	// that Common Fate provisions access with.
+	SSOStartURL string
+	SSORegion   string
+	// Region is written to the region key of the generated profiles, if set.
+	Region string
+
+	// APIURL overrides the Common Fate API URL, which defaults to URL.
+	APIURL string
+	// HTTPClient is used to call the Common Fate API.
+	// Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// commonFateAccountTargetType is the type of AWS account targets in Common Fate.
+const commonFateAccountTargetType = "AWS::Account"
+
+// Name implements NamedSource.
+func (s *CommonFateSource) Name() string {
+	return "commonfate:" + s.URL
+}
+
+// StartURLs implements StartURLSource.
+func (s *CommonFateSource) StartURLs() []string {
+	return []string{s.SSOStartURL}
+}
+
+type commonFateEID struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type commonFateNamedEID struct {
+	EID  commonFateEID `json:"eid"`
+	Name string        `json:"name"`
+}
+
+type commonFateEntitlement struct {
+	Target commonFateNamedEID `json:"target"`
+	Role   commonFateNamedEID `json:"role"`
+}
+
+type queryEntitlementsRequest struct {
+	TargetType string `json:"targetType"`
+	PageToken  string `json:"pageToken,omitempty"`
+}
+
+type queryEntitlementsResponse struct {
+	Entitlements  []commonFateEntitlement `json:"entitlements"`
+	NextPageToken string                  `json:"nextPageToken"`
+}
+
+// GetProfiles implements Source.
+func (s *CommonFateSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	if s.Token == nil {
+		return nil, errors.New("a Common Fate API token provider is required")
+	}
+	token, err := s.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading Common Fate API token: %w", err)
+	}
+
+	var profiles []SSOProfile
+	var pageToken string
+
+	for {
+		var res queryEntitlementsResponse
+		req := queryEntitlementsRequest{TargetType: commonFateAccountTargetType, PageToken: pageToken}
+
+		err = s.call(ctx, token, "commonfate.access.v1alpha1.EntitlementService/QueryEntitlements", req, &res)
+		if err != nil {
+			return nil, fmt.Errorf("querying entitlements: %w", err)
+		}
+
+		for _, e := range res.Entitlements {
+			if e.Target.EID.Type != commonFateAccountTargetType {
+				continue
+			}
+
+			accountName := e.Target.Name
+			if accountName == "" {
+				accountName = e.Target.EID.ID
+			}
+
+			profiles = append(profiles, SSOProfile{
+				SSOStartURL:   s.SSOStartURL,
+				SSORegion:     s.SSORegion,
+				Region:        s.Region,
+				AccountID:     e.Target.EID.ID,
+				AccountName:   accountName,
+				RoleName:      e.Role.Name,
+				CommonFateURL: s.URL,
+				GeneratedFrom: "commonfate",
+			})
+		}
+
+		if res.NextPageToken == "" {
+			return profiles, nil
+		}
+		pageToken = res.NextPageToken
+	}
+}
+
+// errCommonFateUnauthorized is returned if the Common Fate API token is rejected.
+var errCommonFateUnauthorized = errors.New("the Common Fate API token is invalid or expired: run 'cf login' to sign in again")
+
+// call calls a Common Fate API procedure using the Connect protocol with JSON encoding.
+func (s *CommonFateSource) call(ctx context.Context, token string, procedure string, in any, out any) error {
+	endpoint := s.APIURL
+	if endpoint == "" {
+		endpoint = s.URL
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/"+procedure, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return httpStatusError(res.StatusCode, data, errCommonFateUnauthorized)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,126 @@
+package awsconfigfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/ini.v1"
+)
+
+// fakeCommonFate is a fake Common Fate API which returns two pages of entitlements.
+func fakeCommonFate(t *testing.T, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code": "unauthenticated"}`))
+			return
+		}
+		if r.URL.Path != "/commonfate.access.v1alpha1.EntitlementService/QueryEntitlements" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req queryEntitlementsRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, "AWS::Account", req.TargetType)
+
+		res := queryEntitlementsResponse{}
+		if req.PageToken == "" {
+			res.Entitlements = []commonFateEntitlement{
+				{
+					Target: commonFateNamedEID{EID: commonFateEID{Type: "AWS::Account", ID: "123456789012"}, Name: "prod"},
+					Role:   commonFateNamedEID{EID: commonFateEID{Type: "AWS::IDC::PermissionSet", ID: "arn:aws:sso:::permissionSet/ssoins-1/ps-1"}, Name: "AdministratorAccess"},
+				},
+				{
+					Target: commonFateNamedEID{EID: commonFateEID{Type: "GCP::Project", ID: "project"}, Name: "project"},
+					Role:   commonFateNamedEID{EID: commonFateEID{Type: "GCP::Role", ID: "roles/owner"}, Name: "Owner"},
+				},
+			}
+			res.NextPageToken = "page2"
+		} else {
+			res.Entitlements = []commonFateEntitlement{
+				{
+					Target: commonFateNamedEID{EID: commonFateEID{Type: "AWS::Account", ID: "210987654321"}},
+					Role:   commonFateNamedEID{EID: commonFateEID{Type: "AWS::IDC::PermissionSet", ID: "arn:aws:sso:::permissionSet/ssoins-1/ps-2"}, Name: "ReadOnly"},
+				},
+			}
+		}
+
+		err = json.NewEncoder(w).Encode(res)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+}
+
+func TestCommonFateSource_GetProfiles(t *testing.T) {
+	server := fakeCommonFate(t, "valid")
+	defer server.Close()
+
+	s := &CommonFateSource{
+		URL:         "https://commonfate.example.com",
+		APIURL:      server.URL,
+		Token:       func(ctx context.Context) (string, error) { return "valid", nil },
+		SSOStartURL: "https://example.awsapps.com/start",
+		SSORegion:   "us-east-1",
+	}
+
+	got, err := s.GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SSOProfile{
+		{
+			SSOStartURL:   "https://example.awsapps.com/start",
+			SSORegion:     "us-east-1",
+			AccountID:     "123456789012",
+			AccountName:   "prod",
+			RoleName:      "AdministratorAccess",
+			CommonFateURL: "https://commonfate.example.com",
+			GeneratedFrom: "commonfate",
+		},
+		{
+			SSOStartURL:   "https://example.awsapps.com/start",
+			SSORegion:     "us-east-1",
+			AccountID:     "210987654321",
+			AccountName:   "210987654321",
+			RoleName:      "ReadOnly",
+			CommonFateURL: "https://commonfate.example.com",
+			GeneratedFrom: "commonfate",
+		},
+	}
+	assert.Equal(t, want, got)
+
+	// the Common Fate URL is passed to the Granted credential process
+	cfg := ini.Empty()
+	err = Merge(MergeOpts{Config: cfg, Profiles: got[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "granted credential-process --profile prod/AdministratorAccess --url https://commonfate.example.com", cfg.Section("profile prod/AdministratorAccess").Key("credential_process").String())
+}
+
+func TestCommonFateSource_Errors(t *testing.T) {
+	server := fakeCommonFate(t, "valid")
+	defer server.Close()
+
+	s := &CommonFateSource{
+		URL:   server.URL,
+		Token: func(ctx context.Context) (string, error) { return "expired", nil },
+	}
+	_, err := s.GetProfiles(context.Background())
+	assert.True(t, errors.Is(err, errCommonFateUnauthorized), "got %v", err)
+
+	s.Token = func(ctx context.Context) (string, error) { return "", errors.New("not logged in") }
+	_, err = s.GetProfiles(context.Background())
+	assert.EqualError(t, err, "loading Common Fate API token: not logged in")
+}
@@ -0,0 +1,536 @@
+package awsconfigfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// SourceFactory creates a Source from its options in a generator config file.
+type SourceFactory func(c *SourceConfig) (Source, error)
+
+var (
+	sourceFactoriesMu sync.RWMutex
+	sourceFactories   = map[string]SourceFactory{}
+)
+
+// RegisterSource makes a source type available in generator config files,
+// so that third-party sources can be configured in the same way as the built-in ones.
+// It panics if the type is already registered.
+func RegisterSource(typ string, factory SourceFactory) {
+	sourceFactoriesMu.Lock()
+	defer sourceFactoriesMu.Unlock()
+
+	if factory == nil {
+		panic("awsconfigfile: RegisterSource factory is nil")
+	}
+	if _, ok := sourceFactories[typ]; ok {
+		panic("awsconfigfile: RegisterSource called twice for source type " + typ)
+	}
+	sourceFactories[typ] = factory
+}
+
+// SourceTypes returns the registered source types in sorted order.
+func SourceTypes() []string {
+	sourceFactoriesMu.RLock()
+	defer sourceFactoriesMu.RUnlock()
+
+	var types []string
+	for t := range sourceFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// SourceConfig is the configuration of a source in a generator config file.
+type SourceConfig struct {
+	// Type is the registered source type, such as 'aws-sso'.
+	Type string
+	// File and Line are the location of the source in the config file.
+	// Line is zero if it is not known.
+	File string
+	Line int
+
+	decode func(v any) error
+}
+
+// Decode decodes the source's options into v, which should be a pointer to a struct
+// with `yaml` and `toml` field tags. An error is returned for any unknown options.
+func (c *SourceConfig) Decode(v any) error {
+	return c.decode(v)
+}
+
+// Path resolves a path in the source's options. Relative paths are
+// relative to the directory containing the config file, and '~' is expanded.
+func (c *SourceConfig) Path(p string) string {
+	if p == "" {
+		return ""
+	}
+	p = expandHomeDir(p)
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(filepath.Dir(c.File), p)
+}
+
+// generatorFile is the format of a generator config file.
+type generatorFile struct {
+	ProfileNameTemplate    string         `yaml:"profile_name_template" toml:"profile_name_template"`
+	Prefix                 string         `yaml:"prefix" toml:"prefix"`
+	NoCredentialProcess    bool           `yaml:"no_credential_process" toml:"no_credential_process"`
+	PruneStartURLs         []string       `yaml:"prune_start_urls" toml:"prune_start_urls"`
+	SSOSessions            bool           `yaml:"sso_sessions" toml:"sso_sessions"`
+	SSOSessionNameTemplate string         `yaml:"sso_session_name_template" toml:"sso_session_name_template"`
+	ExternalSourceProfiles []string       `yaml:"external_source_profiles" toml:"external_source_profiles"`
+	Filters                []string       `yaml:"filters" toml:"filters"`
+	FilterFile             string         `yaml:"filter_file" toml:"filter_file"`
+	ExtraKeys              []extraKeyFile `yaml:"extra_keys" toml:"extra_keys"`
+	MergePolicy            string         `yaml:"merge_policy" toml:"merge_policy"`
+	KeyConflictStrategy    string         `yaml:"key_conflict_strategy" toml:"key_conflict_strategy"`
+	CollisionStrategy      string         `yaml:"collision_strategy" toml:"collision_strategy"`
+	ContinueOnSourceError  bool           `yaml:"continue_on_source_error" toml:"continue_on_source_error"`
+	MaxConcurrency         int            `yaml:"max_concurrency" toml:"max_concurrency"`
+	SourceTimeout          string         `yaml:"source_timeout" toml:"source_timeout"`
+	Validation             string         `yaml:"validation" toml:"validation"`
+	ExtraRegions           []string       `yaml:"extra_regions" toml:"extra_regions"`
+	Lint                   bool           `yaml:"lint" toml:"lint"`
+	Sources                []rawSource    `yaml:"sources" toml:"sources"`
+}
+
+type extraKeyFile struct {
+	Key    string   `yaml:"key" toml:"key"`
+	Value  string   `yaml:"value" toml:"value"`
+	Nested []string `yaml:"nested" toml:"nested"`
+}
+
+// sourceCommonKeys are options which can be set on any source.
+var sourceCommonKeys = map[string]bool{"type": true, "filter": true, "cache_ttl": true}
+
+// rawSource is a source in a generator config file,
+// which is decoded once its type is known.
+type rawSource struct {
+	yamlNode *yaml.Node
+	tomlData map[string]any
+	// line is the line of the source in the config file, or zero if it is not known.
+	line int
+}
+
+func (r *rawSource) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: source must be a mapping", node.Line)
+	}
+	r.yamlNode = node
+	r.line = node.Line
+	return nil
+}
+
+func (r *rawSource) UnmarshalTOML(data any) error {
+	m, ok := data.(map[string]any)
+	if !ok {
+		return errors.New("source must be a table")
+	}
+	r.tomlData = m
+	return nil
+}
+
+// stringOption returns a common option of the source.
+func (r *rawSource) stringOption(key string) (string, error) {
+	if r.yamlNode != nil {
+		for i := 0; i+1 < len(r.yamlNode.Content); i += 2 {
+			if r.yamlNode.Content[i].Value == key {
+				var s string
+				err := r.yamlNode.Content[i+1].Decode(&s)
+				return s, err
+			}
+		}
+		return "", nil
+	}
+
+	v, ok := r.tomlData[key]
+	if !ok {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return s, nil
+}
+
+// decode decodes the source's options into v, excluding the common options.
+func (r *rawSource) decode(v any) error {
+	if r.yamlNode != nil {
+		options := &yaml.Node{Kind: yaml.MappingNode, Line: r.yamlNode.Line, Column: r.yamlNode.Column}
+		for i := 0; i+1 < len(r.yamlNode.Content); i += 2 {
+			if !sourceCommonKeys[r.yamlNode.Content[i].Value] {
+				options.Content = append(options.Content, r.yamlNode.Content[i], r.yamlNode.Content[i+1])
+			}
+		}
+
+		known := yamlFieldNames(v)
+		for i := 0; i+1 < len(options.Content); i += 2 {
+			key := options.Content[i]
+			if known != nil && !known[key.Value] {
+				return fmt.Errorf("line %d: unknown option %q", key.Line, key.Value)
+			}
+		}
+		return options.Decode(v)
+	}
+
+	options := map[string]any{}
+	for k, val := range r.tomlData {
+		if !sourceCommonKeys[k] {
+			options[k] = val
+		}
+	}
+
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(options)
+	if err != nil {
+		return err
+	}
+	md, err := toml.Decode(buf.String(), v)
+	if err != nil {
+		return err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("unknown option %q", undecoded[0].String())
+	}
+	return nil
+}
+
+// yamlFieldNames returns the yaml field names of the struct that v points to,
+// or nil if v does not point to a struct.
+func yamlFieldNames(v any) map[string]bool {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	t = t.Elem()
+
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// configError is an error at a location in a generator config file.
+func configError(path string, line int, format string, args ...any) error {
+	if line > 0 {
+		return fmt.Errorf("%s:%d: %s", path, line, fmt.Sprintf(format, args...))
+	}
+	return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+}
+
+// configLineError matches errors from the yaml and toml packages which contain a line number,
+// such as 'yaml: line 3: mapping values are not allowed in this context'.
+var configLineError = regexp.MustCompile(`^(?:yaml: |toml: )?line (\d+)(?: \(last key "[^"]*"\))?: (.*)$`)
+
+// locateError formats an error from decoding a config file so that it starts with the file and line,
+// using the line in the error if it has one. prefix is added to the start of the message, if set.
+func locateError(path string, line int, prefix string, err error) error {
+	msg := err.Error()
+	var te *yaml.TypeError
+	if errors.As(err, &te) && len(te.Errors) > 0 {
+		msg = te.Errors[0]
+	}
+	var pe toml.ParseError
+	if errors.As(err, &pe) {
+		msg = pe.Error()
+	}
+
+	if m := configLineError.FindStringSubmatch(msg); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		msg = m[2]
+	}
+	if prefix != "" {
+		msg = prefix + ": " + msg
+	}
+	return configError(path, line, "%s", msg)
+}
+
+// LoadGeneratorConfig creates a Generator from a YAML or TOML config file, such as:
+//
+//	profile_name_template: "{{ .AccountName }}/{{ .RoleName }}"
+//	no_credential_process: true
+//	prune_start_urls: [https://example.awsapps.com/start]
+//	filters:
+//	  - account.name matches "prod-*"
+//	sources:
+//	  - type: aws-sso
+//	    start_url: https://example.awsapps.com/start
+//	    sso_region: us-east-1
+//	    cache_ttl: 1h
+//
+// The format is detected from the file extension. Each source has a type, registered with
+// RegisterSource, and the options for that type. Every source may also have a 'filter' expression,
+// which is parsed with ParseFilter, and a 'cache_ttl', which wraps the source in a CachedSource.
+// If a cached source fails, its cached profiles are used and the Generator reports them as stale
+// in a *PartialFailureError.
+//
+// The returned Generator does not have a Config, which must be set before generating profiles.
+func LoadGeneratorConfig(path string) (*Generator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file generatorFile
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&file)
+		// an empty file is a generator with no sources
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, locateError(path, 0, "", err)
+		}
+		return file.generator(path, yamlKeyLines(data))
+
+	case ".toml":
+		md, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return nil, locateError(path, 0, "", err)
+		}
+
+		keyLines, sourceLines := tomlKeyLines(data)
+		for _, key := range md.Undecoded() {
+			// source options are checked when the source is decoded.
+			if key[0] == "sources" {
+				continue
+			}
+			return nil, configError(path, keyLines[key[0]], "unknown field %q", key.String())
+		}
+		for i := range file.Sources {
+			if i < len(sourceLines) {
+				file.Sources[i].line = sourceLines[i]
+			}
+		}
+		return file.generator(path, keyLines)
+	}
+
+	return nil, fmt.Errorf("%s: unsupported file extension, expected .yaml, .yml or .toml", path)
+}
+
+// generator validates the config file and creates a Generator.
+// keyLines is the line of each top-level key in the file, for errors.
+func (f *generatorFile) generator(path string, keyLines map[string]int) (*Generator, error) {
+	g := Generator{
+		ProfileNameTemplate:    f.ProfileNameTemplate,
+		Prefix:                 f.Prefix,
+		NoCredentialProcess:    f.NoCredentialProcess,
+		PruneStartURLs:         f.PruneStartURLs,
+		SSOSessions:            f.SSOSessions,
+		SSOSessionNameTemplate: f.SSOSessionNameTemplate,
+		ExternalSourceProfiles: f.ExternalSourceProfiles,
+		MergePolicy:            MergePolicy(f.MergePolicy),
+		KeyConflictStrategy:    KeyConflictStrategy(f.KeyConflictStrategy),
+		CollisionStrategy:      CollisionStrategy(f.CollisionStrategy),
+		ContinueOnSourceError:  f.ContinueOnSourceError,
+		MaxConcurrency:         f.MaxConcurrency,
+		Validation:             ValidationMode(f.Validation),
+		ExtraRegions:           f.ExtraRegions,
+		Lint:                   f.Lint,
+	}
+
+	if g.SSOSessions && !g.NoCredentialProcess {
+		return nil, configError(path, keyLines["sso_sessions"], "sso_sessions requires no_credential_process")
+	}
+
+	switch g.MergePolicy {
+	case "", MergePolicyReplace, MergePolicyPreserve:
+	default:
+		return nil, configError(path, keyLines["merge_policy"], "invalid merge_policy %q, expected %q or %q", f.MergePolicy, MergePolicyReplace, MergePolicyPreserve)
+	}
+	switch g.KeyConflictStrategy {
+	case "", KeyConflictOverwrite, KeyConflictKeepExisting, KeyConflictFail:
+	default:
+		return nil, configError(path, keyLines["key_conflict_strategy"], "invalid key_conflict_strategy %q, expected %q, %q or %q", f.KeyConflictStrategy, KeyConflictOverwrite, KeyConflictKeepExisting, KeyConflictFail)
+	}
+	switch g.CollisionStrategy {
+	case "", CollisionFail, CollisionFirstWins, CollisionSuffixAccountID, CollisionSuffixCounter:
+	default:
+		return nil, configError(path, keyLines["collision_strategy"], "invalid collision_strategy %q, expected %q, %q, %q or %q", f.CollisionStrategy, CollisionFail, CollisionFirstWins, CollisionSuffixAccountID, CollisionSuffixCounter)
+	}
+	switch g.Validation {
+	case "", ValidationFail, ValidationSkip, ValidationOff:
+	default:
+		return nil, configError(path, keyLines["validation"], "invalid validation %q, expected %q, %q or %q", f.Validation, ValidationFail, ValidationSkip, ValidationOff)
+	}
+	if f.MaxConcurrency < 0 {
+		return nil, configError(path, keyLines["max_concurrency"], "max_concurrency must not be negative")
+	}
+
+	if f.SourceTimeout != "" {
+		d, err := time.ParseDuration(f.SourceTimeout)
+		if err != nil {
+			return nil, configError(path, keyLines["source_timeout"], "invalid source_timeout: %s", err)
+		}
+		g.SourceTimeout = d
+	}
+
+	for _, kv := range f.ExtraKeys {
+		if kv.Key == "" {
+			return nil, configError(path, keyLines["extra_keys"], "extra_keys must have a key")
+		}
+		if kv.Value != "" && len(kv.Nested) > 0 {
+			return nil, configError(path, keyLines["extra_keys"], "extra key %s must not have both a value and nested values", kv.Key)
+		}
+		g.ExtraKeys = append(g.ExtraKeys, KeyValue{Key: kv.Key, Value: kv.Value, Nested: kv.Nested})
+	}
+
+	var filters []ProfileFilter
+	for _, expr := range f.Filters {
+		filter, err := ParseFilter(expr)
+		if err != nil {
+			return nil, configError(path, keyLines["filters"], "filter %q: %s", expr, err)
+		}
+		filters = append(filters, filter)
+	}
+	if f.FilterFile != "" {
+		c := SourceConfig{File: path}
+		filter, err := LoadFilterFile(c.Path(f.FilterFile))
+		if err != nil {
+			return nil, configError(path, keyLines["filter_file"], "%s", err)
+		}
+		filters = append(filters, filter)
+	}
+	if len(filters) > 0 {
+		g.Filter = AllOf(filters...)
+	}
+
+	for i := range f.Sources {
+		s, err := f.Sources[i].source(path, i)
+		if err != nil {
+			return nil, err
+		}
+		g.Sources = append(g.Sources, s)
+	}
+
+	return &g, nil
+}
+
+// source creates the source using its registered factory.
+func (r *rawSource) source(path string, index int) (Source, error) {
+	typ, err := r.stringOption("type")
+	if err != nil {
+		return nil, locateError(path, r.line, fmt.Sprintf("source %d", index+1), err)
+	}
+	if typ == "" {
+		return nil, configError(path, r.line, "source %d: type is required", index+1)
+	}
+
+	sourceFactoriesMu.RLock()
+	factory, ok := sourceFactories[typ]
+	sourceFactoriesMu.RUnlock()
+	if !ok {
+		return nil, configError(path, r.line, "source %d: unknown type %q, expected one of: %s", index+1, typ, strings.Join(SourceTypes(), ", "))
+	}
+
+	c := SourceConfig{Type: typ, File: path, Line: r.line, decode: r.decode}
+	s, err := factory(&c)
+	if err != nil {
+		return nil, locateError(path, r.line, typ+" source", err)
+	}
+
+	// the filter is applied after caching, so that changes to it take effect immediately.
+	ttl, err := r.stringOption("cache_ttl")
+	if err != nil {
+		return nil, locateError(path, r.line, typ+" source", err)
+	}
+	if ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, configError(path, r.line, "%s source: invalid cache_ttl: %s", typ, err)
+		}
+		s = &CachedSource{Source: s, TTL: d}
+	}
+
+	expr, err := r.stringOption("filter")
+	if err != nil {
+		return nil, locateError(path, r.line, typ+" source", err)
+	}
+	if expr != "" {
+		filter, err := ParseFilter(expr)
+		if err != nil {
+			return nil, configError(path, r.line, "%s source: filter: %s", typ, err)
+		}
+		s = Include(s, filter)
+	}
+
+	return s, nil
+}
+
+// yamlKeyLines returns the line of each top-level key in a YAML document.
+func yamlKeyLines(data []byte) map[string]int {
+	lines := map[string]int{}
+
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) != nil || len(doc.Content) == 0 {
+		return lines
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		lines[root.Content[i].Value] = root.Content[i].Line
+	}
+	return lines
+}
+
+var (
+	tomlKeyPattern           = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\s*=`)
+	tomlSourcesHeaderPattern = regexp.MustCompile(`^\s*\[\[\s*sources\s*\]\]`)
+)
+
+// tomlKeyLines returns the line of each top-level key in a TOML document,
+// and the line of each [[sources]] table.
+func tomlKeyLines(data []byte) (keys map[string]int, sources []int) {
+	keys = map[string]int{}
+	inTable := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+
+		if tomlSourcesHeaderPattern.MatchString(text) {
+			sources = append(sources, line)
+		}
+		if strings.HasPrefix(strings.TrimSpace(text), "[") {
+			inTable = true
+			continue
+		}
+		if m := tomlKeyPattern.FindStringSubmatch(text); m != nil && !inTable {
+			keys[m[1]] = line
+		}
+	}
+	return keys, sources
+}
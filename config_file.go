@@ -0,0 +1,274 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+// ErrConfigFileChanged is returned by SaveConfig if the config file
+// has been modified on disk since it was loaded.
+var ErrConfigFileChanged = errors.New("config file has been modified since it was loaded")
+
+// iniLoadOptions are the options used to parse AWS config files.
+// Nested values are allowed so that sub-sections such as 's3 =' are kept.
+var iniLoadOptions = ini.LoadOptions{AllowNestedValues: true}
+
+// ConfigFile is an AWS config file loaded from disk with LoadConfig.
+type ConfigFile struct {
+	*ini.File
+
+	// Path is the path that the config file was loaded from.
+	// If Path is a symlink, SaveConfig writes to the symlink's target.
+	Path string
+
+	// exists is true if the file existed when it was loaded.
+	exists bool
+	// checksum is the SHA256 checksum of the file when it was loaded,
+	// used to detect if the file is modified before saving.
+	checksum [sha256.Size]byte
+}
+
+// LoadConfig loads an AWS config file from path.
+// If path is empty, the path is resolved with ResolveSharedConfigFilename.
+// An empty config is returned if the file does not exist.
+func LoadConfig(path string) (*ConfigFile, error) {
+	if path == "" {
+		path = ResolveSharedConfigFilename().Path
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ConfigFile{File: ini.Empty(iniLoadOptions), Path: path}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ini.LoadSources(iniLoadOptions, data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	cfg := ConfigFile{
+		File:     file,
+		Path:     path,
+		exists:   true,
+		checksum: sha256.Sum256(data),
+	}
+	return &cfg, nil
+}
+
+// cloneConfig returns a copy of f, parsed with the same options as LoadConfig.
+// An empty config is returned if f is nil.
+func cloneConfig(f *ini.File) (*ini.File, error) {
+	if f == nil {
+		return ini.Empty(iniLoadOptions), nil
+	}
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return ini.LoadSources(iniLoadOptions, buf.Bytes())
+}
+
+// SaveOpts configures SaveConfig.
+type SaveOpts struct {
+	// Backups is the number of timestamped backups of the config file to keep.
+	// The existing file is copied to '<name>.<timestamp>.bak' before it is replaced,
+	// and the oldest backups beyond this number are removed.
+	// If zero, no backups are made.
+	Backups int
+}
+
+// SaveConfig atomically writes the config file back to disk, by writing
+// to a temporary file in the same directory and renaming it over the original.
+// The original file mode is kept, and symlinks are preserved by writing to their target.
+//
+// ErrConfigFileChanged is returned if the file has been modified on disk since it was loaded.
+func SaveConfig(cfg *ConfigFile, opts SaveOpts) error {
+	target, err := resolveSymlinks(cfg.Path)
+	if err != nil {
+		return err
+	}
+
+	var content bytes.Buffer
+	_, err = cfg.File.WriteTo(&content)
+	if err != nil {
+		return err
+	}
+
+	var mode fs.FileMode = 0600
+
+	current, err := os.ReadFile(target)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if cfg.exists {
+			return fmt.Errorf("%s: %w", cfg.Path, ErrConfigFileChanged)
+		}
+	case err != nil:
+		return err
+	default:
+		if !cfg.exists || sha256.Sum256(current) != cfg.checksum {
+			return fmt.Errorf("%s: %w", cfg.Path, ErrConfigFileChanged)
+		}
+
+		fi, err := os.Stat(target)
+		if err != nil {
+			return err
+		}
+		mode = fi.Mode().Perm()
+
+		if opts.Backups > 0 {
+			err = backupConfig(target, current, mode, opts.Backups)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0700)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(target, content.Bytes(), mode)
+	if err != nil {
+		return err
+	}
+
+	cfg.exists = true
+	cfg.checksum = sha256.Sum256(content.Bytes())
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as path,
+// and then renames it to path so that readers never see a partially written file.
+func writeFileAtomic(path string, data []byte, mode fs.FileMode) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// clean up the temporary file if anything below fails.
+	// This is a no-op once the file has been renamed.
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Chmod(mode)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	// sync the directory so that the rename is durable.
+	// Ignore errors, as directories can't be synced on all platforms.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// backupTimeFormat sorts lexically in chronological order.
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// backupConfig writes a timestamped copy of the config file
+// and removes the oldest backups so that only keep backups remain.
+func backupConfig(path string, data []byte, mode fs.FileMode, keep int) error {
+	backup := path + "." + time.Now().UTC().Format(backupTimeFormat) + ".bak"
+	err := writeFileAtomic(backup, data, mode)
+	if err != nil {
+		return fmt.Errorf("backing up %s: %w", path, err)
+	}
+
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, e := range entries {
+		stamp, ok := cutPrefix(e.Name(), name+".")
+		if !ok || e.IsDir() {
+			continue
+		}
+		stamp, ok = cutSuffix(stamp, ".bak")
+		if _, err := time.Parse(backupTimeFormat, stamp); ok && err == nil {
+			backups = append(backups, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(backups)
+
+	for len(backups) > keep {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// resolveSymlinks follows symlinks until a regular file is found.
+// Unlike filepath.EvalSymlinks, the final target does not need to exist.
+func resolveSymlinks(path string) (string, error) {
+	// the same limit as the Linux kernel uses for nested symlinks
+	for i := 0; i < 40; i++ {
+		fi, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return path, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			return path, nil
+		}
+
+		link, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(path), link)
+		}
+		path = link
+	}
+	return "", fmt.Errorf("%s: too many levels of symbolic links", path)
+}
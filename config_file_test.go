@@ -0,0 +1,234 @@
+package awsconfigfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+
+	err := os.WriteFile(path, []byte("[profile example]\ntest = 1\n"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Section("profile example").Key("test").SetValue("2")
+
+	err = SaveConfig(cfg, SaveOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "[profile example]\ntest = 2\n", string(got))
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+	}
+
+	// the config can be saved again after it is written
+	cfg.Section("profile example").Key("test").SetValue("3")
+	err = SaveConfig(cfg, SaveOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no temporary files should be left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, entries, 1)
+}
+
+func TestSaveConfig_NewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".aws", "config")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Section("profile example").Key("test").SetValue("1")
+
+	err = SaveConfig(cfg, SaveOpts{Backups: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "[profile example]\ntest = 1\n", string(got))
+}
+
+func TestSaveConfig_Symlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "aws-config")
+	link := filepath.Join(dir, "config")
+
+	err := os.MkdirAll(filepath.Dir(target), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(target, []byte("[profile example]\ntest = 1\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join("dotfiles", "aws-config"), link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Section("profile example").Key("test").SetValue("2")
+
+	err = SaveConfig(cfg, SaveOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, fi.Mode()&os.ModeSymlink != 0, "symlink should be preserved")
+
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "[profile example]\ntest = 2\n", string(got))
+}
+
+func TestSaveConfig_Backups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+
+	err := os.WriteFile(path, []byte("[profile example]\ntest = 0\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{"1", "2", "3", "4"} {
+		cfg.Section("profile example").Key("test").SetValue(v)
+		err = SaveConfig(cfg, SaveOpts{Backups: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var backups []string
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".bak") {
+			data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			backups = append(backups, string(data))
+		}
+	}
+
+	// only the two most recent versions before the final save are kept
+	assert.Equal(t, []string{"[profile example]\ntest = 2\n", "[profile example]\ntest = 3\n"}, backups)
+}
+
+func TestSaveConfig_ChangedOnDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+
+	err := os.WriteFile(path, []byte("[profile example]\ntest = 1\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte("[profile example]\ntest = edited\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Section("profile example").Key("test").SetValue("2")
+	err = SaveConfig(cfg, SaveOpts{})
+	assert.True(t, errors.Is(err, ErrConfigFileChanged), "expected ErrConfigFileChanged, got %v", err)
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "[profile example]\ntest = edited\n", string(got))
+}
+
+func TestLoadConfig_NestedValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	content := `[profile example]
+region = us-east-1
+s3 =
+  max_concurrent_requests = 20
+  max_queue_size = 1000
+output = json
+`
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec := cfg.Section("profile example")
+	assert.Equal(t, []string{"region", "s3", "output"}, sec.KeyStrings())
+	assert.Equal(t, []string{"max_concurrent_requests = 20", "max_queue_size = 1000"}, sec.Key("s3").NestedValues())
+
+	err = SaveConfig(cfg, SaveOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec = cfg.Section("profile example")
+	assert.Equal(t, []string{"region", "s3", "output"}, sec.KeyStrings())
+	assert.Equal(t, []string{"max_concurrent_requests = 20", "max_queue_size = 1000"}, sec.Key("s3").NestedValues())
+}
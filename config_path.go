@@ -3,8 +3,54 @@ package awsconfigfile
 import (
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// PathSource describes which rule was used to resolve a file path.
+type PathSource string
+
+const (
+	// PathSourceEnv means the path was read from an environment variable,
+	// such as AWS_CONFIG_FILE.
+	PathSourceEnv PathSource = "env"
+	// PathSourceDefault means the default path in the user's home directory was used.
+	PathSourceDefault PathSource = "default"
+)
+
+// ResolvedPath is a file path resolved using the AWS SDK's precedence rules.
+type ResolvedPath struct {
+	Path   string
+	Source PathSource
+	// EnvVar is the environment variable which Path was read from,
+	// if Source is PathSourceEnv.
+	EnvVar string
+}
+
+// ResolveSharedConfigFilename returns the path to the shared config file
+// using the same precedence as the AWS SDKs and CLI:
+//
+//  1. the AWS_CONFIG_FILE environment variable, with a leading '~' expanded to the home directory
+//  2. DefaultSharedConfigFilename
+func ResolveSharedConfigFilename() ResolvedPath {
+	return resolvePath("AWS_CONFIG_FILE", DefaultSharedConfigFilename())
+}
+
+// ResolveSharedCredentialsFilename returns the path to the shared credentials file
+// using the same precedence as the AWS SDKs and CLI:
+//
+//  1. the AWS_SHARED_CREDENTIALS_FILE environment variable, with a leading '~' expanded to the home directory
+//  2. DefaultSharedCredentialsFilename
+func ResolveSharedCredentialsFilename() ResolvedPath {
+	return resolvePath("AWS_SHARED_CREDENTIALS_FILE", DefaultSharedCredentialsFilename())
+}
+
+func resolvePath(envVar string, defaultPath string) ResolvedPath {
+	if p := os.Getenv(envVar); p != "" {
+		return ResolvedPath{Path: expandHomeDir(p), Source: PathSourceEnv, EnvVar: envVar}
+	}
+	return ResolvedPath{Path: defaultPath, Source: PathSourceDefault}
+}
+
 // DefaultSharedConfigFilename returns the AWS SDK's default file path for
 // the shared config file.
 // It is vendored from the AWS Go SDK v2 to prevent importing the entire module.
@@ -17,6 +63,30 @@ func DefaultSharedConfigFilename() string {
 	return filepath.Join(userHomeDir(), ".aws", "config")
 }
 
+// DefaultSharedCredentialsFilename returns the AWS SDK's default file path for
+// the shared credentials file.
+// It is vendored from the AWS Go SDK v2 to prevent importing the entire module.
+//
+// Builds the shared credentials file path based on the OS's platform.
+//
+//   - Linux/Unix: $HOME/.aws/credentials
+//   - Windows: %USERPROFILE%\.aws\credentials
+func DefaultSharedCredentialsFilename() string {
+	return filepath.Join(userHomeDir(), ".aws", "credentials")
+}
+
+// expandHomeDir replaces a leading '~' in path with the user's home directory.
+// '~user' style paths are not expanded.
+func expandHomeDir(path string) string {
+	if path == "~" {
+		return userHomeDir()
+	}
+	if strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return filepath.Join(userHomeDir(), path[2:])
+	}
+	return path
+}
+
 func userHomeDir() string {
 	// Ignore errors since we only care about Windows and *nix.
 	homedir, _ := os.UserHomeDir()
@@ -0,0 +1,61 @@
+package awsconfigfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSharedConfigFilename(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	tests := []struct {
+		name string
+		env  string
+		want ResolvedPath
+	}{
+		{
+			name: "default",
+			want: ResolvedPath{Path: filepath.Join(home, ".aws", "config"), Source: PathSourceDefault},
+		},
+		{
+			name: "env",
+			env:  filepath.Join("custom", "config"),
+			want: ResolvedPath{Path: filepath.Join("custom", "config"), Source: PathSourceEnv, EnvVar: "AWS_CONFIG_FILE"},
+		},
+		{
+			name: "env with home dir",
+			env:  "~/custom/config",
+			want: ResolvedPath{Path: filepath.Join(home, "custom", "config"), Source: PathSourceEnv, EnvVar: "AWS_CONFIG_FILE"},
+		},
+		{
+			name: "other users home dir is not expanded",
+			env:  "~other/config",
+			want: ResolvedPath{Path: "~other/config", Source: PathSourceEnv, EnvVar: "AWS_CONFIG_FILE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_CONFIG_FILE", tt.env)
+			assert.Equal(t, tt.want, ResolveSharedConfigFilename())
+		})
+	}
+}
+
+func TestResolveSharedCredentialsFilename(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "")
+	assert.Equal(t, ResolvedPath{Path: filepath.Join(home, ".aws", "credentials"), Source: PathSourceDefault}, ResolveSharedCredentialsFilename())
+
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "~/creds")
+	assert.Equal(t, ResolvedPath{Path: filepath.Join(home, "creds"), Source: PathSourceEnv, EnvVar: "AWS_SHARED_CREDENTIALS_FILE"}, ResolveSharedCredentialsFilename())
+}
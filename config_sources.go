@@ -0,0 +1,170 @@
+package awsconfigfile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The built-in source types which can be used in generator config files.
+func init() {
+	RegisterSource("aws-sso", newIdentityCenterSourceFromConfig)
+	RegisterSource("file", newFileSourceFromConfig)
+	RegisterSource("exec", newExecSourceFromConfig)
+	RegisterSource("ini", newIniSourceFromConfig)
+	RegisterSource("commonfate", newCommonFateSourceFromConfig)
+}
+
+// requireOptions returns an error listing the options which are empty.
+func requireOptions(options ...[2]string) error {
+	var missing []string
+	for _, o := range options {
+		if o[1] == "" {
+			missing = append(missing, o[0])
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required options: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func newIdentityCenterSourceFromConfig(c *SourceConfig) (Source, error) {
+	var opts struct {
+		StartURL  string `yaml:"start_url" toml:"start_url"`
+		SSORegion string `yaml:"sso_region" toml:"sso_region"`
+		Region    string `yaml:"region" toml:"region"`
+		CacheDir  string `yaml:"cache_dir" toml:"cache_dir"`
+	}
+	err := c.Decode(&opts)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOptions([2]string{"start_url", opts.StartURL}, [2]string{"sso_region", opts.SSORegion})
+	if err != nil {
+		return nil, err
+	}
+
+	s := IdentityCenterSource{
+		StartURL:  opts.StartURL,
+		SSORegion: opts.SSORegion,
+		Region:    opts.Region,
+		CacheDir:  c.Path(opts.CacheDir),
+	}
+	return &s, nil
+}
+
+func newFileSourceFromConfig(c *SourceConfig) (Source, error) {
+	var opts struct {
+		Paths         []string `yaml:"paths" toml:"paths"`
+		GeneratedFrom string   `yaml:"generated_from" toml:"generated_from"`
+	}
+	err := c.Decode(&opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Paths) == 0 {
+		return nil, errors.New("missing required options: paths")
+	}
+
+	s := FileSource{GeneratedFrom: opts.GeneratedFrom}
+	for _, p := range opts.Paths {
+		s.Paths = append(s.Paths, c.Path(p))
+	}
+	return &s, nil
+}
+
+func newExecSourceFromConfig(c *SourceConfig) (Source, error) {
+	var opts struct {
+		Command       string   `yaml:"command" toml:"command"`
+		Args          []string `yaml:"args" toml:"args"`
+		Env           []string `yaml:"env" toml:"env"`
+		Dir           string   `yaml:"dir" toml:"dir"`
+		StartURLs     []string `yaml:"start_urls" toml:"start_urls"`
+		GeneratedFrom string   `yaml:"generated_from" toml:"generated_from"`
+	}
+	err := c.Decode(&opts)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOptions([2]string{"command", opts.Command})
+	if err != nil {
+		return nil, err
+	}
+
+	command := opts.Command
+	// commands without a path separator are looked up in $PATH.
+	if strings.ContainsRune(command, '/') {
+		command = c.Path(command)
+	}
+
+	s := ExecSource{
+		Command:       command,
+		Args:          opts.Args,
+		Env:           opts.Env,
+		Dir:           c.Path(opts.Dir),
+		SSOStartURLs:  opts.StartURLs,
+		GeneratedFrom: opts.GeneratedFrom,
+	}
+	return &s, nil
+}
+
+func newIniSourceFromConfig(c *SourceConfig) (Source, error) {
+	var opts struct {
+		Path          string `yaml:"path" toml:"path"`
+		GeneratedFrom string `yaml:"generated_from" toml:"generated_from"`
+	}
+	err := c.Decode(&opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s := IniSource{Path: c.Path(opts.Path), GeneratedFrom: opts.GeneratedFrom}
+	return &s, nil
+}
+
+// defaultCommonFateTokenEnv is the environment variable containing the Common Fate API token.
+const defaultCommonFateTokenEnv = "COMMON_FATE_TOKEN"
+
+func newCommonFateSourceFromConfig(c *SourceConfig) (Source, error) {
+	var opts struct {
+		URL         string `yaml:"url" toml:"url"`
+		APIURL      string `yaml:"api_url" toml:"api_url"`
+		SSOStartURL string `yaml:"sso_start_url" toml:"sso_start_url"`
+		SSORegion   string `yaml:"sso_region" toml:"sso_region"`
+		Region      string `yaml:"region" toml:"region"`
+		// TokenEnv is the environment variable containing the API token.
+		TokenEnv string `yaml:"token_env" toml:"token_env"`
+	}
+	err := c.Decode(&opts)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOptions([2]string{"url", opts.URL}, [2]string{"sso_start_url", opts.SSOStartURL}, [2]string{"sso_region", opts.SSORegion})
+	if err != nil {
+		return nil, err
+	}
+
+	tokenEnv := opts.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = defaultCommonFateTokenEnv
+	}
+
+	s := CommonFateSource{
+		URL:         opts.URL,
+		APIURL:      opts.APIURL,
+		SSOStartURL: opts.SSOStartURL,
+		SSORegion:   opts.SSORegion,
+		Region:      opts.Region,
+		Token: func(ctx context.Context) (string, error) {
+			token := os.Getenv(tokenEnv)
+			if token == "" {
+				return "", fmt.Errorf("%s is not set", tokenEnv)
+			}
+			return token, nil
+		},
+	}
+	return &s, nil
+}
@@ -0,0 +1,394 @@
+package awsconfigfile
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testConfigSource is registered as the 'test' source type.
+type testConfigSource struct {
+	Profiles []SSOProfile
+}
+
+func (s *testConfigSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	return s.Profiles, nil
+}
+
+func init() {
+	RegisterSource("test", func(c *SourceConfig) (Source, error) {
+		var opts struct {
+			AccountIDs []string `yaml:"account_ids" toml:"account_ids"`
+		}
+		err := c.Decode(&opts)
+		if err != nil {
+			return nil, err
+		}
+		var s testConfigSource
+		for _, id := range opts.AccountIDs {
+			s.Profiles = append(s.Profiles, SSOProfile{
+				SSOStartURL: "https://example.awsapps.com/start",
+				SSORegion:   "us-east-1",
+				AccountID:   id,
+				AccountName: "account-" + id,
+				RoleName:    "Admin",
+			})
+		}
+		return &s, nil
+	})
+}
+
+func TestLoadGeneratorConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    func(t *testing.T, dir string, g *Generator)
+	}{
+		{
+			name: "yaml",
+			file: "generator.yaml",
+			content: `
+profile_name_template: "{{ .AccountName }}/{{ .RoleName }}"
+prefix: cf-
+no_credential_process: true
+prune_start_urls: [https://example.awsapps.com/start]
+extra_keys:
+  - key: output
+    value: json
+collision_strategy: suffix-account-id
+source_timeout: 30s
+lint: true
+validation: skip
+extra_regions: [xx-north-9]
+sources:
+  - type: file
+    paths: [profiles.yaml, ~/profiles.yaml]
+  - type: aws-sso
+    start_url: https://example.awsapps.com/start
+    sso_region: us-east-1
+`,
+			want: func(t *testing.T, dir string, g *Generator) {
+				assert.Equal(t, "{{ .AccountName }}/{{ .RoleName }}", g.ProfileNameTemplate)
+				assert.Equal(t, "cf-", g.Prefix)
+				assert.True(t, g.NoCredentialProcess)
+				assert.Equal(t, []string{"https://example.awsapps.com/start"}, g.PruneStartURLs)
+				assert.Equal(t, []KeyValue{{Key: "output", Value: "json"}}, g.ExtraKeys)
+				assert.Equal(t, CollisionSuffixAccountID, g.CollisionStrategy)
+				assert.Equal(t, 30*time.Second, g.SourceTimeout)
+				assert.True(t, g.Lint)
+				assert.Equal(t, ValidationSkip, g.Validation)
+				assert.Equal(t, []string{"xx-north-9"}, g.ExtraRegions)
+
+				assert.Len(t, g.Sources, 2)
+				assert.Equal(t, &FileSource{Paths: []string{filepath.Join(dir, "profiles.yaml"), expandHomeDir("~/profiles.yaml")}}, g.Sources[0])
+				assert.Equal(t, &IdentityCenterSource{StartURL: "https://example.awsapps.com/start", SSORegion: "us-east-1"}, g.Sources[1])
+			},
+		},
+		{
+			name: "toml",
+			file: "generator.toml",
+			content: `
+prefix = "cf-"
+prune_start_urls = ["https://example.awsapps.com/start"]
+
+[[extra_keys]]
+key = "output"
+value = "json"
+
+[[sources]]
+type = "exec"
+command = "./bin/profiles"
+args = ["--all"]
+
+[[sources]]
+type = "aws-sso"
+start_url = "https://example.awsapps.com/start"
+sso_region = "us-east-1"
+`,
+			want: func(t *testing.T, dir string, g *Generator) {
+				assert.Equal(t, "cf-", g.Prefix)
+				assert.Equal(t, []string{"https://example.awsapps.com/start"}, g.PruneStartURLs)
+				assert.Equal(t, []KeyValue{{Key: "output", Value: "json"}}, g.ExtraKeys)
+
+				assert.Len(t, g.Sources, 2)
+				assert.Equal(t, &ExecSource{Command: filepath.Join(dir, "bin/profiles"), Args: []string{"--all"}}, g.Sources[0])
+				assert.Equal(t, &IdentityCenterSource{StartURL: "https://example.awsapps.com/start", SSORegion: "us-east-1"}, g.Sources[1])
+			},
+		},
+		{
+			name:    "empty yaml",
+			file:    "generator.yaml",
+			content: "",
+			want: func(t *testing.T, dir string, g *Generator) {
+				assert.Equal(t, &Generator{}, g)
+			},
+		},
+		{
+			name: "exec command in PATH is not resolved",
+			file: "generator.yaml",
+			content: `
+sources:
+  - type: exec
+    command: list-profiles
+`,
+			want: func(t *testing.T, dir string, g *Generator) {
+				assert.Equal(t, &ExecSource{Command: "list-profiles"}, g.Sources[0])
+			},
+		},
+		{
+			name: "cache_ttl and filter wrap the source",
+			file: "generator.yaml",
+			content: `
+sources:
+  - type: test
+    account_ids: ["111111111111", "222222222222"]
+    cache_ttl: 1h
+    filter: account.id == "222222222222"
+`,
+			want: func(t *testing.T, dir string, g *Generator) {
+				fs, ok := g.Sources[0].(*FilterSource)
+				if !assert.True(t, ok) {
+					return
+				}
+				cs, ok := fs.Source.(*CachedSource)
+				if !assert.True(t, ok) {
+					return
+				}
+				assert.Equal(t, time.Hour, cs.TTL)
+				assert.IsType(t, &testConfigSource{}, cs.Source)
+
+				// call the filter directly, rather than through the cache
+				fs.Source = cs.Source
+				profiles, err := fs.GetProfiles(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if assert.Len(t, profiles, 1) {
+					assert.Equal(t, "222222222222", profiles[0].AccountID)
+				}
+			},
+		},
+		{
+			name: "filters",
+			file: "generator.yaml",
+			content: `
+filters:
+  - account.id == "111111111111"
+`,
+			want: func(t *testing.T, dir string, g *Generator) {
+				if !assert.NotNil(t, g.Filter) {
+					return
+				}
+				assert.True(t, g.Filter(SSOProfile{AccountID: "111111111111"}))
+				assert.False(t, g.Filter(SSOProfile{AccountID: "222222222222"}))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeTestFile(t, dir, tt.file, tt.content)
+
+			got, err := LoadGeneratorConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want(t, dir, got)
+		})
+	}
+}
+
+func TestLoadGeneratorConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "unknown field",
+			file: "generator.yaml",
+			content: `prefix: cf-
+profile_template: x
+`,
+			wantErr: "generator.yaml:2: field profile_template not found in type awsconfigfile.generatorFile",
+		},
+		{
+			name:    "invalid yaml",
+			file:    "generator.yaml",
+			content: "prefix: [",
+			wantErr: "generator.yaml:1: did not find expected node content",
+		},
+		{
+			name: "invalid enum",
+			file: "generator.yaml",
+			content: `prefix: cf-
+merge_policy: merge
+`,
+			wantErr: `generator.yaml:2: invalid merge_policy "merge", expected "replace" or "preserve"`,
+		},
+		{
+			name: "sso sessions with credential process",
+			file: "generator.yaml",
+			content: `
+sso_sessions: true
+`,
+			wantErr: "generator.yaml:2: sso_sessions requires no_credential_process",
+		},
+		{
+			name: "invalid validation",
+			file: "generator.yaml",
+			content: `
+validation: warn
+`,
+			wantErr: `generator.yaml:2: invalid validation "warn", expected "fail", "skip" or "off"`,
+		},
+		{
+			name: "invalid source_timeout",
+			file: "generator.yaml",
+			content: `
+source_timeout: soon
+`,
+			wantErr: `generator.yaml:2: invalid source_timeout: time: invalid duration "soon"`,
+		},
+		{
+			name: "invalid filter",
+			file: "generator.yaml",
+			content: `
+filters:
+  - account.id ==
+`,
+			wantErr: `generator.yaml:2: filter "account.id ==":`,
+		},
+		{
+			name: "source without type",
+			file: "generator.yaml",
+			content: `
+sources:
+  - start_url: https://example.awsapps.com/start
+`,
+			wantErr: "generator.yaml:3: source 1: type is required",
+		},
+		{
+			name: "unknown source type",
+			file: "generator.yaml",
+			content: `
+sources:
+  - type: okta
+`,
+			wantErr: `generator.yaml:3: source 1: unknown type "okta", expected one of: aws-sso, commonfate, exec, file, ini, test`,
+		},
+		{
+			name: "unknown source option",
+			file: "generator.yaml",
+			content: `
+sources:
+  - type: aws-sso
+    start_url: https://example.awsapps.com/start
+    sso_region: us-east-1
+    regoin: us-east-1
+`,
+			wantErr: `generator.yaml:6: aws-sso source: unknown option "regoin"`,
+		},
+		{
+			name: "missing source options",
+			file: "generator.yaml",
+			content: `
+sources:
+  - type: aws-sso
+`,
+			wantErr: "generator.yaml:3: aws-sso source: missing required options: start_url, sso_region",
+		},
+		{
+			name: "invalid source option type",
+			file: "generator.yaml",
+			content: `
+sources:
+  - type: file
+    paths: {a: b}
+`,
+			wantErr: "generator.yaml:4: file source: cannot unmarshal !!map into []string",
+		},
+		{
+			name: "invalid source filter",
+			file: "generator.yaml",
+			content: `
+sources:
+  - type: test
+    filter: account.id ==
+`,
+			wantErr: "generator.yaml:3: test source: filter:",
+		},
+		{
+			name: "invalid cache_ttl",
+			file: "generator.yaml",
+			content: `
+sources:
+  - type: test
+    cache_ttl: forever
+`,
+			wantErr: `generator.yaml:3: test source: invalid cache_ttl: time: invalid duration "forever"`,
+		},
+		{
+			name: "toml unknown field",
+			file: "generator.toml",
+			content: `prefix = "cf-"
+profile_template = "x"
+`,
+			wantErr: `generator.toml:2: unknown field "profile_template"`,
+		},
+		{
+			name: "toml invalid syntax",
+			file: "generator.toml",
+			content: `prefix = "cf-"
+region = = "x"
+`,
+			wantErr: "generator.toml:2: expected value but found '=' instead",
+		},
+		{
+			name: "toml unknown source option",
+			file: "generator.toml",
+			content: `prefix = "cf-"
+
+[[sources]]
+type = "test"
+
+[[sources]]
+type = "test"
+accounts = ["111111111111"]
+`,
+			wantErr: `generator.toml:6: test source: unknown option "accounts"`,
+		},
+		{
+			name:    "unsupported extension",
+			file:    "generator.json",
+			content: "{}",
+			wantErr: "unsupported file extension, expected .yaml, .yml or .toml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeTestFile(t, dir, tt.file, tt.content)
+
+			_, err := LoadGeneratorConfig(path)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterSource(t *testing.T) {
+	assert.Contains(t, SourceTypes(), "test")
+	assert.Panics(t, func() {
+		RegisterSource("test", func(c *SourceConfig) (Source, error) { return nil, nil })
+	})
+	assert.Panics(t, func() {
+		RegisterSource("nil-factory", nil)
+	})
+}
@@ -0,0 +1,200 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ExecProtocolVersion is the version of the request and response
+// exchanged with an ExecSource command.
+const ExecProtocolVersion = 1
+
+// ExecRequest is written as JSON to the stdin of an ExecSource command.
+type ExecRequest struct {
+	// Version is ExecProtocolVersion.
+	Version int `json:"version"`
+	// Deadline is the time by which the command must respond,
+	// if the context has a deadline.
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// StartURLs are the AWS access portal URLs which profiles are requested for.
+	// If empty, the command should return all of the profiles that it knows about.
+	StartURLs []string `json:"start_urls"`
+}
+
+// execResponse is read as JSON from the stdout of an ExecSource command.
+type execResponse struct {
+	Version  int             `json:"version"`
+	Profiles []profileRecord `json:"profiles"`
+}
+
+// ExecSource loads profiles by running an external command,
+// so that sources can be written in other languages.
+//
+// An ExecRequest is written to the command's stdin as JSON,
+// and the command must write a JSON response to stdout:
+//
+//	{
+//	  "version": 1,
+//	  "profiles": [
+//	    {
+//	      "sso_start_url": "https://example.awsapps.com/start",
+//	      "sso_region": "us-east-1",
+//	      "account_id": "123456789012",
+//	      "account_name": "prod",
+//	      "role_name": "DevRole"
+//	    }
+//	  ]
+//	}
+//
+// Profiles use the same fields as the files read by FileSource.
+// If the command exits with a non-zero status, its stderr is included in the returned error.
+// The command is killed if the context is cancelled. On Unix, the command runs in its own
+// process group and any processes it started are killed too.
+type ExecSource struct {
+	// Command is the path or name of the command to run.
+	Command string
+	// Args are passed to the command.
+	Args []string
+	// Env is added to the environment of the command, in 'KEY=value' form.
+	Env []string
+	// Dir is the working directory of the command.
+	// Defaults to the current directory.
+	Dir string
+	// SSOStartURLs are sent to the command as the requested start URLs.
+	SSOStartURLs []string
+	// GeneratedFrom is written to common_fate_generated_from in the generated profiles.
+	// Defaults to 'exec'.
+	GeneratedFrom string
+}
+
+// Name implements NamedSource.
+func (s *ExecSource) Name() string {
+	return "exec:" + s.Command
+}
+
+// StartURLs implements StartURLSource.
+// If SSOStartURLs is empty the command may return profiles for any start URL,
+// so the start URLs are unknown.
+func (s *ExecSource) StartURLs() []string {
+	return s.SSOStartURLs
+}
+
+// execStderrLimit is the maximum amount of stderr included in errors.
+const execStderrLimit = 4096
+
+// execWaitDelay is how long GetProfiles waits for the command's output to be closed
+// after it is killed, in case it started processes which were not killed with it.
+const execWaitDelay = 2 * time.Second
+
+// GetProfiles implements Source.
+func (s *ExecSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	req := ExecRequest{
+		Version:   ExecProtocolVersion,
+		StartURLs: s.SSOStartURLs,
+	}
+	if req.StartURLs == nil {
+		req.StartURLs = []string{}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		d := deadline.UTC()
+		req.Deadline = &d
+	}
+
+	stdin, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(s.Command, s.Args...)
+	cmd.Dir = s.Dir
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if len(s.Env) > 0 {
+		cmd.Env = append(os.Environ(), s.Env...)
+	}
+	setProcessGroup(cmd)
+
+	err = runCommand(ctx, cmd)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("running %s: %w", s.Command, ctx.Err())
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > execStderrLimit {
+			msg = "..." + msg[len(msg)-execStderrLimit:]
+		}
+		if msg == "" {
+			return nil, fmt.Errorf("running %s: %w", s.Command, err)
+		}
+		return nil, fmt.Errorf("running %s: %w: %s", s.Command, err, msg)
+	}
+
+	var res execResponse
+	err = json.Unmarshal(stdout.Bytes(), &res)
+	if err != nil {
+		return nil, fmt.Errorf("parsing response from %s: %w", s.Command, err)
+	}
+	if res.Version != ExecProtocolVersion {
+		return nil, fmt.Errorf("parsing response from %s: unsupported version %d, expected %d", s.Command, res.Version, ExecProtocolVersion)
+	}
+
+	generatedFrom := s.GeneratedFrom
+	if generatedFrom == "" {
+		generatedFrom = "exec"
+	}
+
+	var profiles []SSOProfile
+	var errs []string
+
+	for i, r := range res.Profiles {
+		p, err := r.toProfile(generatedFrom)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("profile %d: %s", i+1, err))
+			continue
+		}
+		profiles = append(profiles, p)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("parsing response from %s: %s", s.Command, strings.Join(errs, "; "))
+	}
+	return profiles, nil
+}
+
+// runCommand runs cmd, killing its process group if ctx is cancelled.
+// exec.CommandContext only kills the command itself, and waiting for it blocks
+// for as long as any process it started holds its stdout or stderr open.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	_ = killProcessGroup(cmd)
+	select {
+	case err = <-done:
+		return err
+	case <-time.After(execWaitDelay):
+		return ctx.Err()
+	}
+}
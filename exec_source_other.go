@@ -0,0 +1,13 @@
+//go:build !unix
+
+package awsconfigfile
+
+import "os/exec"
+
+// setProcessGroup is a no-op on platforms without process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills cmd. Processes started by cmd are not killed.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,155 @@
+package awsconfigfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// execHelperEnv is set when the test binary is run as an ExecSource command.
+const execHelperEnv = "AWSCONFIGFILE_EXEC_HELPER"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(execHelperEnv); mode != "" {
+		os.Exit(runExecHelper(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// runExecHelper acts as an ExecSource command, responding according to mode.
+func runExecHelper(mode string) int {
+	var req ExecRequest
+	err := json.NewDecoder(os.Stdin).Decode(&req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	switch mode {
+	case "echo":
+		// return a profile for each requested start URL, using the
+		// deadline as the account name so that the test can check it was sent.
+		res := map[string]any{"version": ExecProtocolVersion}
+		var profiles []map[string]string
+		for _, u := range req.StartURLs {
+			name := "no-deadline"
+			if req.Deadline != nil {
+				name = "deadline"
+			}
+			profiles = append(profiles, map[string]string{
+				"sso_start_url": u,
+				"sso_region":    "us-east-1",
+				"account_id":    "123456789012",
+				"account_name":  name,
+				"role_name":     "DevRole",
+			})
+		}
+		res["profiles"] = profiles
+		_ = json.NewEncoder(os.Stdout).Encode(res)
+	case "fail":
+		fmt.Fprintln(os.Stderr, "could not reach the provider")
+		return 1
+	case "version":
+		fmt.Println(`{"version": 99, "profiles": []}`)
+	case "invalid":
+		fmt.Println(`{"version": 1, "profiles": [{"account_id": "123456789012"}]}`)
+	}
+	return 0
+}
+
+func execHelper(mode string) ExecSource {
+	return ExecSource{
+		Command: os.Args[0],
+		Env:     []string{execHelperEnv + "=" + mode},
+	}
+}
+
+func TestExecSource_GetProfiles(t *testing.T) {
+	s := execHelper("echo")
+	s.SSOStartURLs = []string{"https://example.awsapps.com/start"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	got, err := s.GetProfiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SSOProfile{
+		{
+			SSOStartURL:   "https://example.awsapps.com/start",
+			SSORegion:     "us-east-1",
+			AccountID:     "123456789012",
+			AccountName:   "deadline",
+			RoleName:      "DevRole",
+			GeneratedFrom: "exec",
+		},
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestExecSource_Errors(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr string
+	}{
+		{mode: "fail", wantErr: "exit status 1: could not reach the provider"},
+		{mode: "version", wantErr: "unsupported version 99, expected 1"},
+		{mode: "invalid", wantErr: "profile 1: missing required fields: sso_start_url, sso_region, account_name, role_name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			s := execHelper(tt.mode)
+			_, err := s.GetProfiles(context.Background())
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestExecSource_Cancel(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	// sleep is started by bash and inherits its stdout, so the
+	// output is not closed when only bash is killed.
+	s := ExecSource{Command: bash, Args: []string{"-c", "cat >/dev/null; sleep 5; echo '{}'"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = s.GetProfiles(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+	assert.Less(t, time.Since(start), 4*time.Second)
+}
+
+func TestExecSource_FailureWithoutStartURLsSkipsPruning(t *testing.T) {
+	cfg := parseIni(t, `
+[profile prod/DevRole]
+sso_start_url              = https://example.awsapps.com/start
+common_fate_generated_from = exec
+`)
+	s := execHelper("fail")
+	g := &Generator{
+		Sources:               []Source{&s},
+		Config:                cfg,
+		ContinueOnSourceError: true,
+		PruneStartURLs:        []string{"https://example.awsapps.com/start"},
+	}
+	err := g.Generate(context.Background())
+
+	var partialErr *PartialFailureError
+	if assert.True(t, errors.As(err, &partialErr), "expected a *PartialFailureError, got %v", err) {
+		assert.True(t, partialErr.PruningSkipped)
+		assert.Equal(t, []string{"https://example.awsapps.com/start"}, partialErr.SkippedPruneStartURLs)
+	}
+	assert.True(t, cfg.HasSection("profile prod/DevRole"))
+}
@@ -0,0 +1,253 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ProfilesFileSchema is the JSON Schema for the files read by FileSource.
+//
+//go:embed profiles.schema.json
+var ProfilesFileSchema []byte
+
+// FileSource loads profiles from YAML, JSON or TOML files,
+// such as a list of break-glass accounts which is checked in to a repository.
+//
+// The file format is described by ProfilesFileSchema. For example:
+//
+//	sso_start_url: https://example.awsapps.com/start
+//	sso_region: ap-southeast-2
+//	profiles:
+//	  - account_id: "123456789012"
+//	    account_name: prod
+//	    role_name: BreakGlass
+//
+// The top-level sso_start_url, sso_region and region are used
+// for any profiles which don't set them.
+type FileSource struct {
+	// Paths are the files to load, which may be glob patterns such as 'accounts/*.yaml'.
+	// The format of each file is detected from its extension:
+	// '.yaml' or '.yml', '.json', or '.toml'.
+	Paths []string
+	// GeneratedFrom is written to common_fate_generated_from in the generated profiles.
+	// Defaults to 'file'.
+	GeneratedFrom string
+}
+
+// Name implements NamedSource.
+func (s *FileSource) Name() string {
+	return "file:" + strings.Join(s.Paths, ",")
+}
+
+// GetProfiles implements Source.
+func (s *FileSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	files, err := expandGlobs(s.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	generatedFrom := s.GeneratedFrom
+	if generatedFrom == "" {
+		generatedFrom = "file"
+	}
+
+	var profiles []SSOProfile
+	for _, f := range files {
+		got, err := loadProfilesFile(f, generatedFrom)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, got...)
+	}
+	return profiles, nil
+}
+
+// expandGlobs returns the files matching the patterns in sorted order,
+// without duplicates. An error is returned if a pattern does not match any files.
+func expandGlobs(patterns []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(expandHomeDir(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+
+		sort.Strings(matches)
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// profilesFile is the format of the files read by FileSource.
+type profilesFile struct {
+	SSOStartURL string          `json:"sso_start_url" yaml:"sso_start_url" toml:"sso_start_url"`
+	SSORegion   string          `json:"sso_region" yaml:"sso_region" toml:"sso_region"`
+	Region      string          `json:"region" yaml:"region" toml:"region"`
+	Profiles    []profileRecord `json:"profiles" yaml:"profiles" toml:"profiles"`
+}
+
+// profileRecord is a profile in a file read by FileSource
+// or in the response from an ExecSource.
+type profileRecord struct {
+	SSOStartURL   string `json:"sso_start_url" yaml:"sso_start_url" toml:"sso_start_url"`
+	SSORegion     string `json:"sso_region" yaml:"sso_region" toml:"sso_region"`
+	Region        string `json:"region" yaml:"region" toml:"region"`
+	AccountID     string `json:"account_id" yaml:"account_id" toml:"account_id"`
+	AccountName   string `json:"account_name" yaml:"account_name" toml:"account_name"`
+	RoleName      string `json:"role_name" yaml:"role_name" toml:"role_name"`
+	CommonFateURL string `json:"common_fate_url" yaml:"common_fate_url" toml:"common_fate_url"`
+
+	OU              string            `json:"ou" yaml:"ou" toml:"ou"`
+	AccountEmail    string            `json:"account_email" yaml:"account_email" toml:"account_email"`
+	RoleDescription string            `json:"role_description" yaml:"role_description" toml:"role_description"`
+	Tags            map[string]string `json:"tags" yaml:"tags" toml:"tags"`
+	// Metadata is copied to SSOProfile.Metadata, for keys which
+	// don't have their own field.
+	Metadata map[string]string `json:"metadata" yaml:"metadata" toml:"metadata"`
+}
+
+// metadata returns the profile metadata for the record, or nil if it has none.
+func (r profileRecord) metadata() Metadata {
+	m := Metadata{}
+	for k, v := range r.Metadata {
+		m[k] = v
+	}
+	for k, v := range r.Tags {
+		m[MetadataTagPrefix+k] = v
+	}
+	if r.OU != "" {
+		m[MetadataOU] = r.OU
+	}
+	if r.AccountEmail != "" {
+		m[MetadataAccountEmail] = r.AccountEmail
+	}
+	if r.RoleDescription != "" {
+		m[MetadataRoleDescription] = r.RoleDescription
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// toProfile validates the record and converts it to an SSOProfile.
+func (r profileRecord) toProfile(generatedFrom string) (SSOProfile, error) {
+	var missing []string
+	if r.SSOStartURL == "" {
+		missing = append(missing, "sso_start_url")
+	}
+	if r.SSORegion == "" {
+		missing = append(missing, "sso_region")
+	}
+	if r.AccountID == "" {
+		missing = append(missing, "account_id")
+	}
+	if r.AccountName == "" {
+		missing = append(missing, "account_name")
+	}
+	if r.RoleName == "" {
+		missing = append(missing, "role_name")
+	}
+	if len(missing) > 0 {
+		return SSOProfile{}, fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+
+	p := SSOProfile{
+		SSOStartURL:   r.SSOStartURL,
+		SSORegion:     r.SSORegion,
+		Region:        r.Region,
+		AccountID:     r.AccountID,
+		AccountName:   r.AccountName,
+		RoleName:      r.RoleName,
+		CommonFateURL: r.CommonFateURL,
+		GeneratedFrom: generatedFrom,
+		Metadata:      r.metadata(),
+	}
+	return p, nil
+}
+
+// loadProfilesFile reads and validates the profiles in a file.
+func loadProfilesFile(path string, generatedFrom string) ([]SSOProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file profilesFile
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&file)
+		// an empty file is an empty list of profiles
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&file)
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), &file)
+		if err == nil && len(md.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown field %s", md.Undecoded()[0])
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported file extension, expected .yaml, .yml, .json or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var profiles []SSOProfile
+	var errs []string
+
+	for i, r := range file.Profiles {
+		if r.SSOStartURL == "" {
+			r.SSOStartURL = file.SSOStartURL
+		}
+		if r.SSORegion == "" {
+			r.SSORegion = file.SSORegion
+		}
+		if r.Region == "" {
+			r.Region = file.Region
+		}
+
+		p, err := r.toProfile(generatedFrom)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("profile %d: %s", i+1, err))
+			continue
+		}
+		profiles = append(profiles, p)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(errs, "; "))
+	}
+	return profiles, nil
+}
@@ -0,0 +1,261 @@
+package awsconfigfile
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileSource_GetProfiles(t *testing.T) {
+	prod := SSOProfile{
+		SSOStartURL:   "https://example.awsapps.com/start",
+		SSORegion:     "ap-southeast-2",
+		AccountID:     "123456789012",
+		AccountName:   "prod",
+		RoleName:      "BreakGlass",
+		GeneratedFrom: "file",
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []SSOProfile
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			file: "profiles.yaml",
+			content: `
+sso_start_url: https://example.awsapps.com/start
+sso_region: ap-southeast-2
+profiles:
+  - account_id: "123456789012"
+    account_name: prod
+    role_name: BreakGlass
+`,
+			want: []SSOProfile{prod},
+		},
+		{
+			name: "yaml unquoted account ID keeps leading zeros",
+			file: "profiles.yml",
+			content: `
+profiles:
+  - sso_start_url: https://example.awsapps.com/start
+    sso_region: ap-southeast-2
+    account_id: 012345678901
+    account_name: prod
+    role_name: BreakGlass
+`,
+			want: []SSOProfile{{
+				SSOStartURL:   "https://example.awsapps.com/start",
+				SSORegion:     "ap-southeast-2",
+				AccountID:     "012345678901",
+				AccountName:   "prod",
+				RoleName:      "BreakGlass",
+				GeneratedFrom: "file",
+			}},
+		},
+		{
+			name: "json",
+			file: "profiles.json",
+			content: `{
+  "profiles": [
+    {
+      "sso_start_url": "https://example.awsapps.com/start",
+      "sso_region": "ap-southeast-2",
+      "account_id": "123456789012",
+      "account_name": "prod",
+      "role_name": "BreakGlass"
+    }
+  ]
+}`,
+			want: []SSOProfile{prod},
+		},
+		{
+			name: "toml",
+			file: "profiles.toml",
+			content: `
+sso_start_url = "https://example.awsapps.com/start"
+sso_region = "ap-southeast-2"
+region = "us-east-1"
+
+[[profiles]]
+account_id = "123456789012"
+account_name = "prod"
+role_name = "BreakGlass"
+region = "us-west-2"
+
+[[profiles]]
+account_id = "210987654321"
+account_name = "dev"
+role_name = "BreakGlass"
+`,
+			want: []SSOProfile{
+				{
+					SSOStartURL:   "https://example.awsapps.com/start",
+					SSORegion:     "ap-southeast-2",
+					Region:        "us-west-2",
+					AccountID:     "123456789012",
+					AccountName:   "prod",
+					RoleName:      "BreakGlass",
+					GeneratedFrom: "file",
+				},
+				{
+					SSOStartURL:   "https://example.awsapps.com/start",
+					SSORegion:     "ap-southeast-2",
+					Region:        "us-east-1",
+					AccountID:     "210987654321",
+					AccountName:   "dev",
+					RoleName:      "BreakGlass",
+					GeneratedFrom: "file",
+				},
+			},
+		},
+		{
+			name: "yaml with metadata",
+			file: "profiles.yaml",
+			content: `
+sso_start_url: https://example.awsapps.com/start
+sso_region: ap-southeast-2
+profiles:
+  - account_id: "123456789012"
+    account_name: prod
+    role_name: BreakGlass
+    ou: Root/Workloads/Production
+    account_email: prod@example.com
+    role_description: Emergency access
+    tags:
+      environment: production
+    metadata:
+      cost_centre: "1234"
+`,
+			want: []SSOProfile{{
+				SSOStartURL:   "https://example.awsapps.com/start",
+				SSORegion:     "ap-southeast-2",
+				AccountID:     "123456789012",
+				AccountName:   "prod",
+				RoleName:      "BreakGlass",
+				GeneratedFrom: "file",
+				Metadata: Metadata{
+					MetadataOU:              "Root/Workloads/Production",
+					MetadataAccountEmail:    "prod@example.com",
+					MetadataRoleDescription: "Emergency access",
+					"tag:environment":       "production",
+					"cost_centre":           "1234",
+				},
+			}},
+		},
+		{
+			name:    "empty yaml",
+			file:    "profiles.yaml",
+			content: "",
+		},
+		{
+			name: "missing required fields",
+			file: "profiles.yaml",
+			content: `
+profiles:
+  - account_id: "123456789012"
+    role_name: BreakGlass
+  - sso_start_url: https://example.awsapps.com/start
+    sso_region: ap-southeast-2
+    account_id: "123456789012"
+    account_name: prod
+`,
+			wantErr: "profile 1: missing required fields: sso_start_url, sso_region, account_name; profile 2: missing required fields: role_name",
+		},
+		{
+			name: "unknown yaml field",
+			file: "profiles.yaml",
+			content: `
+profiles:
+  - account: prod
+`,
+			wantErr: "field account not found",
+		},
+		{
+			name:    "unknown json field",
+			file:    "profiles.json",
+			content: `{"profile": []}`,
+			wantErr: `unknown field "profile"`,
+		},
+		{
+			name:    "unknown toml field",
+			file:    "profiles.toml",
+			content: "[[profiles]]\naccount = \"prod\"\n",
+			wantErr: "unknown field profiles.account",
+		},
+		{
+			name:    "unsupported extension",
+			file:    "profiles.txt",
+			content: "",
+			wantErr: "unsupported file extension",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, t.TempDir(), tt.file, tt.content)
+
+			s := FileSource{Paths: []string{path}}
+			got, err := s.GetProfiles(context.Background())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFileSource_Globs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "b.yaml", "sso_start_url: https://example.awsapps.com/start\nsso_region: us-east-1\nprofiles:\n  - {account_id: '222222222222', account_name: b, role_name: Admin}\n")
+	writeTestFile(t, dir, "a.json", `{"sso_start_url": "https://example.awsapps.com/start", "sso_region": "us-east-1", "profiles": [{"account_id": "111111111111", "account_name": "a", "role_name": "Admin"}]}`)
+
+	s := FileSource{
+		// b.yaml matches both patterns, but is only loaded once.
+		Paths:         []string{filepath.Join(dir, "*"), filepath.Join(dir, "b.yaml")},
+		GeneratedFrom: "break-glass",
+	}
+	got, err := s.GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, p := range got {
+		names = append(names, p.AccountName)
+		assert.Equal(t, "break-glass", p.GeneratedFrom)
+	}
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	s = FileSource{Paths: []string{filepath.Join(dir, "*.toml")}}
+	_, err = s.GetProfiles(context.Background())
+	assert.ErrorContains(t, err, "no files match")
+}
+
+func TestProfilesFileSchema(t *testing.T) {
+	var schema map[string]any
+	err := json.Unmarshal(ProfilesFileSchema, &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "object", schema["type"])
+}
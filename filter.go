@@ -0,0 +1,274 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// ProfileFilter reports whether a profile matches the filter.
+type ProfileFilter func(p SSOProfile) bool
+
+// MatchAccountIDs matches profiles for any of the account IDs.
+func MatchAccountIDs(ids ...string) ProfileFilter {
+	set := stringSet(ids)
+	return func(p SSOProfile) bool {
+		return set[p.AccountID]
+	}
+}
+
+// MatchAccountNameGlob matches profiles with an account name matching any of the
+// glob patterns, such as 'sandbox-*'. The pattern syntax is described in path.Match.
+func MatchAccountNameGlob(patterns ...string) (ProfileFilter, error) {
+	for _, pattern := range patterns {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid account name pattern %q: %w", pattern, err)
+		}
+	}
+
+	return func(p SSOProfile) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p.AccountName); ok {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// MatchAccountNameRegexp matches profiles with an account name matching re.
+func MatchAccountNameRegexp(re *regexp.Regexp) ProfileFilter {
+	return func(p SSOProfile) bool {
+		return re.MatchString(p.AccountName)
+	}
+}
+
+// MatchRoleNames matches profiles for any of the role names.
+func MatchRoleNames(names ...string) ProfileFilter {
+	set := stringSet(names)
+	return func(p SSOProfile) bool {
+		return set[p.RoleName]
+	}
+}
+
+// MatchStartURLs matches profiles for any of the SSO start URLs.
+func MatchStartURLs(urls ...string) ProfileFilter {
+	set := stringSet(urls)
+	return func(p SSOProfile) bool {
+		return set[p.SSOStartURL]
+	}
+}
+
+// Not matches profiles which don't match f.
+func Not(f ProfileFilter) ProfileFilter {
+	return func(p SSOProfile) bool {
+		return !f(p)
+	}
+}
+
+// AnyOf matches profiles which match any of the filters.
+func AnyOf(filters ...ProfileFilter) ProfileFilter {
+	return func(p SSOProfile) bool {
+		for _, f := range filters {
+			if f(p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllOf matches profiles which match all of the filters.
+func AllOf(filters ...ProfileFilter) ProfileFilter {
+	return func(p SSOProfile) bool {
+		for _, f := range filters {
+			if !f(p) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// FilterSource removes profiles returned by another Source.
+// A profile is kept if it matches all of the Include filters
+// and none of the Exclude filters.
+//
+// Assume role profiles are returned unchanged.
+type FilterSource struct {
+	Source  Source
+	Include []ProfileFilter
+	Exclude []ProfileFilter
+}
+
+// Include returns a source with only the profiles from s which match all of the filters.
+func Include(s Source, filters ...ProfileFilter) *FilterSource {
+	return &FilterSource{Source: s, Include: filters}
+}
+
+// Exclude returns a source with the profiles from s which match any of the filters removed.
+func Exclude(s Source, filters ...ProfileFilter) *FilterSource {
+	return &FilterSource{Source: s, Exclude: filters}
+}
+
+// Name implements NamedSource.
+func (s *FilterSource) Name() string {
+	return sourceName(s.Source)
+}
+
+// Unwrap returns the underlying source.
+func (s *FilterSource) Unwrap() Source {
+	return s.Source
+}
+
+// GetProfiles implements Source.
+func (s *FilterSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	profiles, err := s.Source.GetProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	include := AllOf(s.Include...)
+	exclude := AnyOf(s.Exclude...)
+
+	var filtered []SSOProfile
+	for _, p := range profiles {
+		if include(p) && !exclude(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered, nil
+}
+
+// GetAssumeRoleProfiles implements AssumeRoleSource.
+func (s *FilterSource) GetAssumeRoleProfiles(ctx context.Context) ([]AssumeRoleProfile, error) {
+	return getAssumeRoleProfiles(ctx, s.Source)
+}
+
+// getAssumeRoleProfiles returns the assume role profiles from s,
+// or nil if s does not implement AssumeRoleSource.
+func getAssumeRoleProfiles(ctx context.Context, s Source) ([]AssumeRoleProfile, error) {
+	if rs, ok := s.(AssumeRoleSource); ok {
+		return rs.GetAssumeRoleProfiles(ctx)
+	}
+	return nil, nil
+}
+
+// MapSource modifies each profile returned by another Source, such as to rewrite regions.
+//
+// Assume role profiles are returned unchanged.
+type MapSource struct {
+	Source Source
+	// Map is called for each profile and returns the profile to use instead.
+	Map func(p SSOProfile) (SSOProfile, error)
+}
+
+// Name implements NamedSource.
+func (s *MapSource) Name() string {
+	return sourceName(s.Source)
+}
+
+// Unwrap returns the underlying source.
+func (s *MapSource) Unwrap() Source {
+	return s.Source
+}
+
+// GetProfiles implements Source.
+func (s *MapSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	profiles, err := s.Source.GetProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := make([]SSOProfile, 0, len(profiles))
+	for _, p := range profiles {
+		m, err := s.Map(p)
+		if err != nil {
+			return nil, fmt.Errorf("mapping profile %s/%s: %w", p.AccountName, p.RoleName, err)
+		}
+		mapped = append(mapped, m)
+	}
+	return mapped, nil
+}
+
+// GetAssumeRoleProfiles implements AssumeRoleSource.
+func (s *MapSource) GetAssumeRoleProfiles(ctx context.Context) ([]AssumeRoleProfile, error) {
+	return getAssumeRoleProfiles(ctx, s.Source)
+}
+
+// templateFields are the profile fields which can be set by MapTemplates.
+var templateFields = map[string]func(p *SSOProfile) *string{
+	"SSOStartURL":   func(p *SSOProfile) *string { return &p.SSOStartURL },
+	"SSORegion":     func(p *SSOProfile) *string { return &p.SSORegion },
+	"AccountID":     func(p *SSOProfile) *string { return &p.AccountID },
+	"AccountName":   func(p *SSOProfile) *string { return &p.AccountName },
+	"RoleName":      func(p *SSOProfile) *string { return &p.RoleName },
+	"Region":        func(p *SSOProfile) *string { return &p.Region },
+	"CommonFateURL": func(p *SSOProfile) *string { return &p.CommonFateURL },
+}
+
+// MapTemplates returns a function for MapSource which sets profile fields
+// by rendering Go templates with the original profile, such as:
+//
+//	MapTemplates(map[string]string{
+//		"Region": `{{ if hasPrefix "eu-" .AccountName }}eu-west-1{{ else }}{{ .Region }}{{ end }}`,
+//	})
+//
+// The keys are the names of SSOProfile string fields.
+// The functions from https://masterminds.github.io/sprig/ are available in the templates.
+func MapTemplates(fields map[string]string) (func(p SSOProfile) (SSOProfile, error), error) {
+	type fieldTemplate struct {
+		name  string
+		field func(p *SSOProfile) *string
+		tmpl  *template.Template
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var templates []fieldTemplate
+	for _, name := range names {
+		field, ok := templateFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported profile field %q", name)
+		}
+		tmpl, err := template.New(name).Funcs(sprig.TxtFuncMap()).Parse(fields[name])
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, fieldTemplate{name: name, field: field, tmpl: tmpl})
+	}
+
+	return func(p SSOProfile) (SSOProfile, error) {
+		// every template is rendered with the original profile,
+		// so that the result does not depend on the order of the fields.
+		original := p
+		for _, t := range templates {
+			var b bytes.Buffer
+			err := t.tmpl.Execute(&b, original)
+			if err != nil {
+				return SSOProfile{}, err
+			}
+			*t.field(&p) = b.String()
+		}
+		return p, nil
+	}, nil
+}
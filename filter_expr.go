@@ -0,0 +1,408 @@
+package awsconfigfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FilterSyntaxError is returned by ParseFilter if a filter expression is invalid.
+type FilterSyntaxError struct {
+	// Column is the 1-based column of the error in the expression.
+	Column int
+	Msg    string
+}
+
+func (e *FilterSyntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// filterFields are the profile fields which can be used in filter expressions.
+var filterFields = map[string]func(p SSOProfile) string{
+	"account.id":       func(p SSOProfile) string { return p.AccountID },
+	"account.name":     func(p SSOProfile) string { return p.AccountName },
+	"role":             func(p SSOProfile) string { return p.RoleName },
+	"role.name":        func(p SSOProfile) string { return p.RoleName },
+	"sso.start_url":    func(p SSOProfile) string { return p.SSOStartURL },
+	"sso.region":       func(p SSOProfile) string { return p.SSORegion },
+	"region":           func(p SSOProfile) string { return p.Region },
+	"generated_from":   func(p SSOProfile) string { return p.GeneratedFrom },
+	"account.ou":       func(p SSOProfile) string { return p.OU() },
+	"account.email":    func(p SSOProfile) string { return p.AccountEmail() },
+	"role.description": func(p SSOProfile) string { return p.RoleDescription() },
+}
+
+// filterField returns a function which gets the value of a field from a profile.
+// Account tags are available as 'tag.<key>', and other metadata as 'metadata.<key>'.
+func filterField(name string) (func(p SSOProfile) string, bool) {
+	if get, ok := filterFields[name]; ok {
+		return get, true
+	}
+	if key, ok := cutPrefix(name, "tag."); ok && key != "" {
+		return func(p SSOProfile) string { return p.Tag(key) }, true
+	}
+	if key, ok := cutPrefix(name, "metadata."); ok && key != "" {
+		return func(p SSOProfile) string { return p.Metadata[key] }, true
+	}
+	return nil, false
+}
+
+// ParseFilter parses a filter expression, such as:
+//
+//	account.name matches "prod-*" && role != "ReadOnly"
+//
+// Expressions compare a profile field with a double-quoted string using
+// '==', '!=', 'matches' (a glob pattern, as described in path.Match) or '=~' (a regular expression).
+// Comparisons can be combined with '&&', '||', '!' and parentheses.
+// Anything after a '#' outside of a string is a comment.
+//
+// The fields are account.id, account.name, role (or role.name),
+// sso.start_url, sso.region, region and generated_from, and the metadata fields
+// account.ou, account.email, role.description, tag.<key> and metadata.<key>.
+//
+// A *FilterSyntaxError is returned if the expression is invalid.
+func ParseFilter(expr string) (ProfileFilter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &FilterSyntaxError{Column: t.col, Msg: fmt.Sprintf("unexpected %s", t)}
+	}
+	return f, nil
+}
+
+// LoadFilterFile reads filter expressions from a file, one per line.
+// A profile matches if it matches every expression in the file.
+// Blank lines and lines starting with '#' are ignored.
+func LoadFilterFile(name string) (ProfileFilter, error) {
+	f, err := os.Open(expandHomeDir(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var filters []ProfileFilter
+	scanner := bufio.NewScanner(f)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if trimmed := strings.TrimSpace(text); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		filter, err := ParseFilter(text)
+		if se, ok := err.(*FilterSyntaxError); ok {
+			return nil, fmt.Errorf("%s:%d:%d: %s", name, line, se.Column, se.Msg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		filters = append(filters, filter)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return AllOf(filters...), nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenEq
+	tokenNotEq
+	tokenRegexp
+	tokenMatches
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type filterToken struct {
+	kind tokenKind
+	// value is the identifier or the unquoted string.
+	value string
+	// col is the 1-based column of the start of the token.
+	col int
+}
+
+func (t filterToken) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenIdent:
+		return fmt.Sprintf("%q", t.value)
+	case tokenString:
+		return "string " + strconv.Quote(t.value)
+	case tokenEq:
+		return "'=='"
+	case tokenNotEq:
+		return "'!='"
+	case tokenRegexp:
+		return "'=~'"
+	case tokenMatches:
+		return "'matches'"
+	case tokenAnd:
+		return "'&&'"
+	case tokenOr:
+		return "'||'"
+	case tokenNot:
+		return "'!'"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	}
+	return "unknown token"
+}
+
+// lexFilter splits a filter expression into tokens.
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	i := 0
+	col := 1
+
+	for i < len(expr) {
+		r, size := utf8.DecodeRuneInString(expr[i:])
+		start := col
+
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			col++
+			continue
+
+		case r == '#':
+			// the rest of the line is a comment
+			i = len(expr)
+			continue
+
+		case r == '"':
+			// find the closing quote, skipping escaped characters
+			j := i + 1
+			for j < len(expr) && expr[j] != '"' {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return nil, &FilterSyntaxError{Column: start, Msg: "unterminated string"}
+			}
+			value, err := strconv.Unquote(expr[i : j+1])
+			if err != nil {
+				return nil, &FilterSyntaxError{Column: start, Msg: "invalid string: " + err.Error()}
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, value: value, col: start})
+			col += utf8.RuneCountInString(expr[i : j+1])
+			i = j + 1
+			continue
+
+		case isIdentRune(r):
+			j := i
+			for j < len(expr) {
+				r, size := utf8.DecodeRuneInString(expr[j:])
+				if !isIdentRune(r) {
+					break
+				}
+				j += size
+			}
+			word := expr[i:j]
+			kind := tokenIdent
+			if word == "matches" {
+				kind = tokenMatches
+			}
+			tokens = append(tokens, filterToken{kind: kind, value: word, col: start})
+			col += utf8.RuneCountInString(word)
+			i = j
+			continue
+		}
+
+		var kind tokenKind
+		var width int
+
+		switch {
+		case strings.HasPrefix(expr[i:], "=="):
+			kind, width = tokenEq, 2
+		case strings.HasPrefix(expr[i:], "!="):
+			kind, width = tokenNotEq, 2
+		case strings.HasPrefix(expr[i:], "=~"):
+			kind, width = tokenRegexp, 2
+		case strings.HasPrefix(expr[i:], "&&"):
+			kind, width = tokenAnd, 2
+		case strings.HasPrefix(expr[i:], "||"):
+			kind, width = tokenOr, 2
+		case r == '!':
+			kind, width = tokenNot, 1
+		case r == '(':
+			kind, width = tokenLParen, 1
+		case r == ')':
+			kind, width = tokenRParen, 1
+		default:
+			return nil, &FilterSyntaxError{Column: start, Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+
+		tokens = append(tokens, filterToken{kind: kind, col: start})
+		i += width
+		col += width
+	}
+
+	tokens = append(tokens, filterToken{kind: tokenEOF, col: col})
+	return tokens, nil
+}
+
+// isIdentRune reports whether r can be used in a field name.
+// ':', '/' and '@' are allowed so that tag keys such as 'tag.team:owner' can be used.
+func isIdentRune(r rune) bool {
+	return strings.ContainsRune("_.-:/@", r) || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// filterParser is a recursive descent parser for filter expressions:
+//
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | "(" or ")" | comparison
+//	comparison = field ( "==" | "!=" | "matches" | "=~" ) string
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) parseOr() (ProfileFilter, error) {
+	f, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		f = AnyOf(f, rhs)
+	}
+	return f, nil
+}
+
+func (p *filterParser) parseAnd() (ProfileFilter, error) {
+	f, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		f = AllOf(f, rhs)
+	}
+	return f, nil
+}
+
+func (p *filterParser) parseUnary() (ProfileFilter, error) {
+	t := p.peek()
+
+	switch t.kind {
+	case tokenNot:
+		p.next()
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(f), nil
+
+	case tokenLParen:
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, &FilterSyntaxError{Column: closing.col, Msg: fmt.Sprintf("expected ')' to close '(' at column %d, got %s", t.col, closing)}
+		}
+		return f, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (ProfileFilter, error) {
+	field := p.next()
+	if field.kind != tokenIdent {
+		return nil, &FilterSyntaxError{Column: field.col, Msg: fmt.Sprintf("expected a field name, got %s", field)}
+	}
+	get, ok := filterField(field.value)
+	if !ok {
+		return nil, &FilterSyntaxError{Column: field.col, Msg: fmt.Sprintf("unknown field %q", field.value)}
+	}
+
+	op := p.next()
+	switch op.kind {
+	case tokenEq, tokenNotEq, tokenMatches, tokenRegexp:
+	default:
+		return nil, &FilterSyntaxError{Column: op.col, Msg: fmt.Sprintf("expected '==', '!=', 'matches' or '=~' after %s, got %s", field.value, op)}
+	}
+
+	value := p.next()
+	if value.kind != tokenString {
+		return nil, &FilterSyntaxError{Column: value.col, Msg: fmt.Sprintf("expected a quoted string, got %s", value)}
+	}
+
+	switch op.kind {
+	case tokenEq:
+		return func(p SSOProfile) bool { return get(p) == value.value }, nil
+
+	case tokenNotEq:
+		return func(p SSOProfile) bool { return get(p) != value.value }, nil
+
+	case tokenMatches:
+		_, err := path.Match(value.value, "")
+		if err != nil {
+			return nil, &FilterSyntaxError{Column: value.col, Msg: fmt.Sprintf("invalid pattern: %s", err)}
+		}
+		return func(p SSOProfile) bool {
+			ok, _ := path.Match(value.value, get(p))
+			return ok
+		}, nil
+
+	default:
+		re, err := regexp.Compile(value.value)
+		if err != nil {
+			return nil, &FilterSyntaxError{Column: value.col, Msg: fmt.Sprintf("invalid regular expression: %s", err)}
+		}
+		return func(p SSOProfile) bool { return re.MatchString(get(p)) }, nil
+	}
+}
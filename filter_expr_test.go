@@ -0,0 +1,149 @@
+package awsconfigfile
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/ini.v1"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: `account.name == "prod"`, want: []string{"prod/Admin", "prod/ReadOnly"}},
+		{expr: `account.name matches "*prod*" && role != "ReadOnly"`, want: []string{"prod/Admin", "eu-prod/Admin"}},
+		{expr: `account.name =~ "^sandbox-" || account.id == "333333333333"`, want: []string{"sandbox-alice/Admin", "eu-prod/Admin"}},
+		{expr: `!(sso.start_url == "https://one.awsapps.com/start")`, want: []string{"eu-prod/Admin"}},
+		{expr: `! role.name == "Admin"`, want: []string{"prod/ReadOnly"}},
+		// && binds more tightly than ||
+		{expr: `role == "ReadOnly" || account.name == "eu-prod" && role == "Admin"`, want: []string{"prod/ReadOnly", "eu-prod/Admin"}},
+		{expr: `region == "us-east-1" # all of them`, want: []string{"prod/Admin", "prod/ReadOnly", "sandbox-alice/Admin", "eu-prod/Admin"}},
+		{expr: `account.name == "\"quoted\""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Include(testSource{Profiles: filterTestProfiles}, f).GetProfiles(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, profileNames(got))
+		})
+	}
+}
+
+func TestParseFilter_Errors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: ``, wantErr: "column 1: expected a field name, got end of expression"},
+		{expr: `account.nme == "prod"`, wantErr: `column 1: unknown field "account.nme"`},
+		{expr: `role = "Admin"`, wantErr: `column 6: unexpected character '='`},
+		{expr: `role == Admin`, wantErr: `column 9: expected a quoted string, got "Admin"`},
+		{expr: `role == "Admin`, wantErr: "column 9: unterminated string"},
+		{expr: `(role == "Admin"`, wantErr: "column 17: expected ')' to close '(' at column 1, got end of expression"},
+		{expr: `role == "Admin" role == "x"`, wantErr: `column 17: unexpected "role"`},
+		{expr: `role "Admin"`, wantErr: `column 6: expected '==', '!=', 'matches' or '=~' after role, got string "Admin"`},
+		{expr: `role =~ "("`, wantErr: "column 9: invalid regular expression"},
+		{expr: `role matches "["`, wantErr: "column 14: invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseFilter(tt.expr)
+			assert.ErrorContains(t, err, tt.wantErr)
+
+			var se *FilterSyntaxError
+			assert.True(t, errors.As(err, &se))
+		})
+	}
+}
+
+func TestParseFilter_Metadata(t *testing.T) {
+	profiles := []SSOProfile{
+		{AccountName: "prod", RoleName: "Admin", Metadata: Metadata{MetadataOU: "Root/Production", "tag:team:owner": "payments", MetadataAccountEmail: "prod@example.com"}},
+		{AccountName: "dev", RoleName: "Admin", Metadata: Metadata{MetadataOU: "Root/Development", "tag:team:owner": "platform"}},
+		{AccountName: "legacy", RoleName: "Admin"},
+	}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: `account.ou matches "Root/Prod*"`, want: []string{"prod/Admin"}},
+		{expr: `tag.team:owner == "platform"`, want: []string{"dev/Admin"}},
+		{expr: `account.email =~ "@example.com$"`, want: []string{"prod/Admin"}},
+		{expr: `metadata.ou == ""`, want: []string{"legacy/Admin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Include(testSource{Profiles: profiles}, f).GetProfiles(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, profileNames(got))
+		})
+	}
+}
+
+func TestLoadFilterFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "filters", `
+# only production accounts
+account.name matches "*prod"
+
+role != "ReadOnly"
+`)
+
+	f, err := LoadFilterFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Include(testSource{Profiles: filterTestProfiles}, f).GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"prod/Admin", "eu-prod/Admin"}, profileNames(got))
+
+	path = writeTestFile(t, dir, "invalid", "role == \"Admin\"\nrole == Admin\n")
+	_, err = LoadFilterFile(path)
+	assert.EqualError(t, err, filepath.Join(dir, "invalid")+`:2:9: expected a quoted string, got "Admin"`)
+}
+
+func TestGenerator_Filter(t *testing.T) {
+	f, err := ParseFilter(`account.name == "prod"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var profiles []SSOProfile
+	for _, p := range filterTestProfiles {
+		p.SSORegion = "us-east-1"
+		profiles = append(profiles, p)
+	}
+
+	cfg := ini.Empty()
+	g := Generator{
+		Config:              cfg,
+		Sources:             []Source{testSource{Profiles: profiles}},
+		NoCredentialProcess: true,
+		Filter:              f,
+	}
+	err = g.Generate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"DEFAULT", "profile prod/Admin", "profile prod/ReadOnly"}, cfg.SectionStrings())
+}
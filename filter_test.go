@@ -0,0 +1,134 @@
+package awsconfigfile
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var filterTestProfiles = []SSOProfile{
+	{SSOStartURL: "https://one.awsapps.com/start", AccountID: "111111111111", AccountName: "prod", RoleName: "Admin", Region: "us-east-1"},
+	{SSOStartURL: "https://one.awsapps.com/start", AccountID: "111111111111", AccountName: "prod", RoleName: "ReadOnly", Region: "us-east-1"},
+	{SSOStartURL: "https://one.awsapps.com/start", AccountID: "222222222222", AccountName: "sandbox-alice", RoleName: "Admin", Region: "us-east-1"},
+	{SSOStartURL: "https://two.awsapps.com/start", AccountID: "333333333333", AccountName: "eu-prod", RoleName: "Admin", Region: "us-east-1"},
+}
+
+func profileNames(profiles []SSOProfile) []string {
+	var names []string
+	for _, p := range profiles {
+		names = append(names, p.AccountName+"/"+p.RoleName)
+	}
+	return names
+}
+
+func TestFilterSource(t *testing.T) {
+	sandbox, err := MatchAccountNameGlob("sandbox-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source Source
+		want   []string
+	}{
+		{
+			name:   "include account IDs",
+			source: Include(testSource{Profiles: filterTestProfiles}, MatchAccountIDs("111111111111", "333333333333")),
+			want:   []string{"prod/Admin", "prod/ReadOnly", "eu-prod/Admin"},
+		},
+		{
+			name:   "exclude account name glob",
+			source: Exclude(testSource{Profiles: filterTestProfiles}, sandbox),
+			want:   []string{"prod/Admin", "prod/ReadOnly", "eu-prod/Admin"},
+		},
+		{
+			name:   "include account name regexp",
+			source: Include(testSource{Profiles: filterTestProfiles}, MatchAccountNameRegexp(regexp.MustCompile(`prod$`))),
+			want:   []string{"prod/Admin", "prod/ReadOnly", "eu-prod/Admin"},
+		},
+		{
+			name:   "include role names",
+			source: Include(testSource{Profiles: filterTestProfiles}, MatchRoleNames("ReadOnly")),
+			want:   []string{"prod/ReadOnly"},
+		},
+		{
+			name: "composed",
+			source: Exclude(
+				Include(testSource{Profiles: filterTestProfiles}, MatchStartURLs("https://one.awsapps.com/start")),
+				AnyOf(sandbox, Not(MatchRoleNames("Admin"))),
+			),
+			want: []string{"prod/Admin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.source.GetProfiles(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, profileNames(got))
+		})
+	}
+}
+
+func TestMatchAccountNameGlob_Invalid(t *testing.T) {
+	_, err := MatchAccountNameGlob("[")
+	assert.Error(t, err)
+}
+
+func TestFilterSource_AssumeRoleProfiles(t *testing.T) {
+	roles := []AssumeRoleProfile{{AccountID: "444444444444", RoleName: "Auditor", SourceProfile: "prod/Admin"}}
+	s := Include(testSource{Profiles: filterTestProfiles, AssumeRoleProfiles: roles}, MatchRoleNames("none"))
+
+	got, err := loadSource(context.Background(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, got.Profiles)
+	assert.Equal(t, roles, got.AssumeRoleProfiles)
+}
+
+func TestMapSource(t *testing.T) {
+	s := &MapSource{
+		Source: testSource{Profiles: filterTestProfiles[:2]},
+		Map: func(p SSOProfile) (SSOProfile, error) {
+			p.AccountName = strings.ToUpper(p.AccountName)
+			return p, nil
+		},
+	}
+	got, err := s.GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"PROD/Admin", "PROD/ReadOnly"}, profileNames(got))
+}
+
+func TestMapTemplates(t *testing.T) {
+	m, err := MapTemplates(map[string]string{
+		"Region":      `{{ if hasPrefix "eu-" .AccountName }}eu-west-1{{ else }}{{ .Region }}{{ end }}`,
+		"AccountName": `{{ .AccountName | trimPrefix "eu-" }}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &MapSource{Source: testSource{Profiles: filterTestProfiles}, Map: m}
+	got, err := s.GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var regions []string
+	for _, p := range got {
+		regions = append(regions, p.Region)
+	}
+	assert.Equal(t, []string{"us-east-1", "us-east-1", "us-east-1", "eu-west-1"}, regions)
+	assert.Equal(t, []string{"prod/Admin", "prod/ReadOnly", "sandbox-alice/Admin", "prod/Admin"}, profileNames(got))
+
+	_, err = MapTemplates(map[string]string{"GeneratedFrom": "x"})
+	assert.EqualError(t, err, `unsupported profile field "GeneratedFrom"`)
+}
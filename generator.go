@@ -2,10 +2,12 @@ package awsconfigfile
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"regexp"
 	"strings"
-	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/ini.v1"
@@ -16,6 +18,167 @@ type Source interface {
 	GetProfiles(ctx context.Context) ([]SSOProfile, error)
 }
 
+// AssumeRoleSource is an optional interface which a Source may implement
+// to return assume role profiles, in addition to the SSO profiles
+// returned by GetProfiles.
+type AssumeRoleSource interface {
+	GetAssumeRoleProfiles(ctx context.Context) ([]AssumeRoleProfile, error)
+}
+
+// NamedSource is an optional interface which a Source may implement
+// to identify itself in errors, such as 'aws-sso:https://example.awsapps.com/start'.
+type NamedSource interface {
+	Name() string
+}
+
+// StartURLSource is an optional interface which a Source may implement
+// to report the SSO start URLs which it returns profiles for.
+// When Generator.ContinueOnSourceError is true, pruning is skipped for the
+// start URLs of failed sources. If a failed source does not implement StartURLSource,
+// or returns no start URLs because it returns profiles for any start URL, pruning is skipped entirely.
+//
+// Sources which wrap another source may implement `Unwrap() Source`,
+// in which case the start URLs of the wrapped source are used.
+type StartURLSource interface {
+	StartURLs() []string
+}
+
+// StaleSource is an optional interface which a Source may implement to report that
+// the profiles it last returned are stale, such as CachedSource when the source it wraps fails.
+// Generator reports stale sources in a *PartialFailureError, and existing profiles are not
+// pruned for their start URLs. Sources which wrap a StaleSource are checked with `Unwrap() Source`.
+type StaleSource interface {
+	Stale() *StaleError
+}
+
+// unwrapSource returns the source wrapped by s, for sources such as
+// CachedSource which implement `Unwrap() Source`, or nil if s does not wrap another source.
+func unwrapSource(s Source) Source {
+	if w, ok := s.(interface{ Unwrap() Source }); ok {
+		return w.Unwrap()
+	}
+	return nil
+}
+
+// sourceStartURLs returns the start URLs of s, or of the first source
+// that it wraps which implements StartURLSource.
+// It returns false if the start URLs are unknown, including if the source returns none.
+func sourceStartURLs(s Source) ([]string, bool) {
+	for s != nil {
+		if us, ok := s.(StartURLSource); ok {
+			urls := us.StartURLs()
+			return urls, len(urls) > 0
+		}
+		s = unwrapSource(s)
+	}
+	return nil, false
+}
+
+// sourceStale returns the *StaleError of s, or of the first source
+// that it wraps which implements StaleSource.
+func sourceStale(s Source) *StaleError {
+	for s != nil {
+		if ss, ok := s.(StaleSource); ok {
+			return ss.Stale()
+		}
+		s = unwrapSource(s)
+	}
+	return nil
+}
+
+// sourceOptions returns the options of s, or of the first source
+// that it wraps which implements SourceOptionsProvider.
+func sourceOptions(s Source) SourceOptions {
+	for s != nil {
+		if sop, ok := s.(SourceOptionsProvider); ok {
+			return sop.SourceOptions()
+		}
+		s = unwrapSource(s)
+	}
+	return SourceOptions{}
+}
+
+// sourceName returns the name of a source for use in errors.
+func sourceName(s Source) string {
+	if ns, ok := s.(NamedSource); ok {
+		return ns.Name()
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// SourceError is an error returned by a Source.
+type SourceError struct {
+	// Source is the name of the source which failed.
+	Source string
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("loading profiles from %s: %s", e.Source, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// PartialFailureError is returned by Generate and Plan when ContinueOnSourceError
+// is true and some sources failed, or when stale cached profiles were used for a source.
+// The profiles from the other sources are still merged.
+//
+// Merge and Generate also return a PartialFailureError after updating the config
+// if invalid profiles were skipped, or profile name collisions were resolved.
+type PartialFailureError struct {
+	Errors []*SourceError
+	// Stale are the sources which failed and returned cached profiles instead.
+	// See StaleSource for details.
+	Stale []*StaleError
+	// Skipped is the invalid profiles which were skipped
+	// because the validation mode is ValidationSkip.
+	Skipped []InvalidProfile
+	// Collisions are profiles with the same name which were skipped or renamed
+	// using the CollisionStrategy.
+	Collisions []Collision
+	// PruningSkipped is true if pruning was skipped entirely, because a
+	// failed source does not implement StartURLSource.
+	PruningSkipped bool
+	// SkippedPruneStartURLs are the PruneStartURLs which were not pruned
+	// because a source for them failed.
+	SkippedPruneStartURLs []string
+}
+
+func (e *PartialFailureError) Error() string {
+	var parts []string
+	if len(e.Errors) > 0 {
+		var msgs []string
+		for _, err := range e.Errors {
+			msgs = append(msgs, err.Error())
+		}
+		parts = append(parts, fmt.Sprintf("%d of the sources failed: %s", len(e.Errors), strings.Join(msgs, "; ")))
+	}
+	if len(e.Stale) > 0 {
+		var msgs []string
+		for _, err := range e.Stale {
+			msgs = append(msgs, err.Error())
+		}
+		parts = append(parts, fmt.Sprintf("%d of the sources used stale cached profiles: %s", len(e.Stale), strings.Join(msgs, "; ")))
+	}
+	if len(e.Skipped) > 0 {
+		var msgs []string
+		for _, p := range e.Skipped {
+			msgs = append(msgs, p.String())
+		}
+		parts = append(parts, fmt.Sprintf("%d invalid profiles were skipped: %s", len(e.Skipped), strings.Join(msgs, "; ")))
+	}
+	if len(e.Collisions) > 0 {
+		var msgs []string
+		for _, c := range e.Collisions {
+			msgs = append(msgs, c.String())
+		}
+		parts = append(parts, fmt.Sprintf("%d profile names collided: %s", len(e.Collisions), strings.Join(msgs, "; ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
 // Generator generates AWS profiles for ~/.aws/config.
 // It reads profiles from sources and merges them with
 // an existing ini config file.
@@ -28,6 +191,54 @@ type Generator struct {
 	// PruneStartURLs is a slice of AWS SSO start URLs which profiles are being generated for.
 	// Existing profiles with these start URLs will be removed if they aren't found in the Profiles field.
 	PruneStartURLs []string
+	// SSOSessions causes generated profiles to reference shared [sso-session] sections.
+	// It only applies when NoCredentialProcess is true, and is ignored otherwise.
+	// See MergeOpts.SSOSessions for details.
+	SSOSessions            bool
+	SSOSessionNameTemplate string
+	// ExternalSourceProfiles are profile names which exist outside of the config file,
+	// such as in ~/.aws/credentials. Assume role profiles may use these as their source_profile.
+	ExternalSourceProfiles []string
+	// Filter removes SSO profiles from all sources which don't match it, if set.
+	// Filters can be written as expressions with ParseFilter or LoadFilterFile.
+	Filter ProfileFilter
+	// ExtraKeys are written to every generated profile.
+	// See MergeOpts.ExtraKeys for details.
+	ExtraKeys []KeyValue
+	// MergePolicy and KeyConflictStrategy control how existing profiles are updated.
+	// See MergeOpts.MergePolicy for details.
+	MergePolicy         MergePolicy
+	KeyConflictStrategy KeyConflictStrategy
+	// CollisionStrategy controls what happens when profiles have the same name.
+	// Profiles from sources added first are considered first.
+	// See MergeOpts.CollisionStrategy for details.
+	CollisionStrategy CollisionStrategy
+	// ContinueOnSourceError merges the profiles from the sources which succeed,
+	// rather than failing if any source returns an error.
+	// Generate and Plan return a *PartialFailureError after merging if any sources failed,
+	// and existing profiles are not pruned for the start URLs of the failed sources.
+	// Sources which return stale cached profiles are always reported in the same way,
+	// even if ContinueOnSourceError is false.
+	ContinueOnSourceError bool
+	// MaxConcurrency is the maximum number of sources to load at once.
+	// If zero, all sources are loaded at once.
+	MaxConcurrency int
+	// SourceTimeout is the deadline for loading each source, including any retries.
+	// If zero, sources are only limited by the context passed to Generate.
+	// Sources may override this by implementing SourceOptionsProvider.
+	SourceTimeout time.Duration
+	// Retry is the retry policy for sources which return a retryable error.
+	// Sources may override this by implementing SourceOptionsProvider.
+	Retry RetryPolicy
+	// Validation controls how invalid profiles are handled, and ExtraRegions are accepted
+	// in addition to the known AWS regions. Invalid profiles are reported with the name of their source.
+	// Skipped profiles are reported by Plan in ChangeSet.Skipped.
+	// See MergeOpts.Validation for details.
+	Validation   ValidationMode
+	ExtraRegions []string
+	// Lint checks the config file after merging and before it is modified.
+	// See MergeOpts.Lint for details.
+	Lint bool
 }
 
 // AddSource adds a new source to load profiles from to the generator.
@@ -47,13 +258,93 @@ var DefaultProfileNameTemplate = "{{ .AccountName }}/{{ .RoleName }}"
 
 // Generate AWS profiles and merge them with the existing config.
 // Writes output to the generator's output.
+//
+// A *PartialFailureError is returned after merging if any sources failed and ContinueOnSourceError
+// is true, if any sources returned stale cached profiles, if any invalid profiles were skipped,
+// or if any profile name collisions were resolved.
 func (g *Generator) Generate(ctx context.Context) error {
-	var eg errgroup.Group
-	var mu sync.Mutex
-	var profiles []SSOProfile
+	opts, skipped, partialErr, err := g.mergeOpts(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = Merge(opts)
+	var mergeErr *PartialFailureError
+	if err != nil && !errors.As(err, &mergeErr) {
+		return err
+	}
+	if len(skipped) > 0 || mergeErr != nil {
+		if partialErr == nil {
+			partialErr = &PartialFailureError{}
+		}
+		// the generator's skipped profiles are reported instead of Merge's, as they name the source.
+		partialErr.Skipped = skipped
+		if mergeErr != nil {
+			partialErr.Collisions = mergeErr.Collisions
+		}
+	}
+	if partialErr != nil {
+		return partialErr
+	}
+	return nil
+}
+
+// Plan loads AWS profiles from the generator's sources and returns
+// the changes that Generate would make, without modifying the generator's config.
+//
+// If ContinueOnSourceError is true, or a source returns stale cached profiles,
+// both the changes and a *PartialFailureError may be returned.
+func (g *Generator) Plan(ctx context.Context) (*ChangeSet, error) {
+	opts, skipped, partialErr, err := g.mergeOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := Plan(opts)
+	if err != nil {
+		return nil, err
+	}
+	// the generator's skipped profiles are reported instead of Merge's, as they name the source.
+	cs.Skipped = skipped
+	if partialErr != nil {
+		return cs, partialErr
+	}
+	return cs, nil
+}
+
+// ExportSwitchRoles loads AWS profiles from the generator's sources and writes the
+// configuration for the AWS Extend Switch Roles browser extension, using the same profile names
+// as Generate. The generator's config is not modified. See ExportSwitchRoles for details.
+//
+// If ContinueOnSourceError is true, the profiles from the sources which succeeded are written
+// and a *PartialFailureError is returned. Stale cached profiles are reported in the same way.
+func (g *Generator) ExportSwitchRoles(ctx context.Context, w io.Writer, sr SwitchRolesOpts) error {
+	opts, _, partialErr, err := g.mergeOpts(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = ExportSwitchRoles(w, opts, sr)
+	if err != nil {
+		return err
+	}
+	if partialErr != nil {
+		return partialErr
+	}
+	return nil
+}
+
+// mergeOpts validates the generator's settings and loads and validates profiles from its sources,
+// returning the invalid profiles which were skipped.
+// A *PartialFailureError is returned alongside the options if any sources failed
+// and ContinueOnSourceError is true, or if any sources returned stale cached profiles.
+func (g *Generator) mergeOpts(ctx context.Context) (MergeOpts, []InvalidProfile, *PartialFailureError, error) {
+	// results are stored by source index so that profiles are
+	// merged in the order that sources were added.
+	results := make([]sourceResult, len(g.Sources))
 
 	if strings.ContainsAny(g.Prefix, profileSectionIllegalChars) {
-		return fmt.Errorf("profile prefix must not contain any of these illegal characters (%s)", profileSectionIllegalChars)
+		return MergeOpts{}, nil, nil, fmt.Errorf("profile prefix must not contain any of these illegal characters (%s)", profileSectionIllegalChars)
 	}
 
 	// use the default template if it's not provided
@@ -65,36 +356,175 @@ func (g *Generator) Generate(ctx context.Context) error {
 	if g.ProfileNameTemplate != DefaultProfileNameTemplate {
 		cleaned := matchGoTemplateSection.ReplaceAllString(g.ProfileNameTemplate, "")
 		if profileSectionIllegalCharsRegex.MatchString(cleaned) {
-			return fmt.Errorf("profile template must not contain any of these illegal characters (%s)", profileSectionIllegalChars)
+			return MergeOpts{}, nil, nil, fmt.Errorf("profile template must not contain any of these illegal characters (%s)", profileSectionIllegalChars)
 		}
 	}
 
-	for _, s := range g.Sources {
-		scopy := s
+	// the other sources are cancelled if a source fails and ContinueOnSourceError is false.
+	eg, loadCtx := errgroup.WithContext(ctx)
+	if g.MaxConcurrency > 0 {
+		eg.SetLimit(g.MaxConcurrency)
+	}
+
+	for i, s := range g.Sources {
+		i, scopy := i, s
 		eg.Go(func() error {
-			got, err := scopy.GetProfiles(ctx)
+			r, err := g.loadSourceWithRetry(loadCtx, scopy)
 			if err != nil {
-				return err
+				srcErr := &SourceError{Source: sourceName(scopy), Err: err}
+				if !g.ContinueOnSourceError {
+					return srcErr
+				}
+				r.Err = srcErr
+			} else {
+				r.Stale = sourceStale(scopy)
 			}
-			mu.Lock()
-			defer mu.Unlock()
-			profiles = append(profiles, got...)
+			results[i] = r
 			return nil
 		})
 	}
 
 	err := eg.Wait()
 	if err != nil {
-		return err
+		return MergeOpts{}, nil, nil, err
+	}
+
+	var profiles []SSOProfile
+	// profileSources is the name of the source of each profile, for validation errors.
+	var profileSources []string
+	var roleProfiles []AssumeRoleProfile
+	var partialErr *PartialFailureError
+	skipPrune := map[string]bool{}
+
+	for i, r := range results {
+		if r.Err != nil || r.Stale != nil {
+			if partialErr == nil {
+				partialErr = &PartialFailureError{}
+			}
+			if r.Err != nil {
+				partialErr.Errors = append(partialErr.Errors, r.Err)
+			} else {
+				partialErr.Stale = append(partialErr.Stale, r.Stale)
+			}
+
+			if startURLs, ok := sourceStartURLs(g.Sources[i]); ok {
+				for _, u := range startURLs {
+					skipPrune[u] = true
+				}
+			} else {
+				partialErr.PruningSkipped = true
+			}
+			if r.Err != nil {
+				continue
+			}
+		}
+
+		for _, p := range r.Profiles {
+			if g.Filter == nil || g.Filter(p) {
+				profiles = append(profiles, p)
+				profileSources = append(profileSources, sourceName(g.Sources[i]))
+			}
+		}
+		roleProfiles = append(roleProfiles, r.AssumeRoleProfiles...)
 	}
 
-	err = Merge(MergeOpts{
+	// profiles are validated here so that errors name the source. Skipped profiles are
+	// still passed to Merge, which skips them too while keeping their existing sections.
+	_, skipped, err := validateProfiles(profiles, g.Validation, g.ExtraRegions, func(i int) string {
+		return profileSources[i]
+	})
+	if err != nil {
+		return MergeOpts{}, nil, nil, err
+	}
+
+	pruneStartURLs := g.PruneStartURLs
+	if partialErr != nil {
+		pruneStartURLs = nil
+		for _, u := range g.PruneStartURLs {
+			if partialErr.PruningSkipped || skipPrune[u] {
+				partialErr.SkippedPruneStartURLs = append(partialErr.SkippedPruneStartURLs, u)
+				continue
+			}
+			pruneStartURLs = append(pruneStartURLs, u)
+		}
+	}
+
+	opts := MergeOpts{
 		Config:              g.Config,
 		SectionNameTemplate: g.ProfileNameTemplate,
 		Profiles:            profiles,
 		NoCredentialProcess: g.NoCredentialProcess,
 		Prefix:              g.Prefix,
-		PruneStartURLs:      g.PruneStartURLs,
+		PruneStartURLs:      pruneStartURLs,
+
+		SSOSessions:            g.SSOSessions,
+		SSOSessionNameTemplate: g.SSOSessionNameTemplate,
+
+		AssumeRoleProfiles:     roleProfiles,
+		ExternalSourceProfiles: g.ExternalSourceProfiles,
+		ExtraKeys:              g.ExtraKeys,
+		MergePolicy:            g.MergePolicy,
+		KeyConflictStrategy:    g.KeyConflictStrategy,
+		CollisionStrategy:      g.CollisionStrategy,
+		Validation:             g.Validation,
+		ExtraRegions:           g.ExtraRegions,
+		Lint:                   g.Lint,
+	}
+	return opts, skipped, partialErr, nil
+}
+
+// sourceResult is the profiles loaded from a source.
+type sourceResult struct {
+	Profiles           []SSOProfile
+	AssumeRoleProfiles []AssumeRoleProfile
+	// Err is set if the source failed and ContinueOnSourceError is true.
+	Err *SourceError
+	// Stale is set if the source returned stale cached profiles.
+	Stale *StaleError
+}
+
+// loadSourceWithRetry loads a source using the source's timeout and retry policy.
+func (g *Generator) loadSourceWithRetry(ctx context.Context, s Source) (sourceResult, error) {
+	timeout := g.SourceTimeout
+	policy := g.Retry
+
+	opts := sourceOptions(s)
+	if opts.Timeout != 0 {
+		timeout = opts.Timeout
+	}
+	if opts.Retry != nil {
+		policy = *opts.Retry
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var r sourceResult
+	err := retry(ctx, policy, func(ctx context.Context) error {
+		var err error
+		r, err = loadSource(ctx, s)
+		return err
 	})
-	return err
+	return r, err
+}
+
+// loadSource loads SSO profiles and assume role profiles from a source.
+func loadSource(ctx context.Context, s Source) (sourceResult, error) {
+	got, err := s.GetProfiles(ctx)
+	if err != nil {
+		return sourceResult{}, err
+	}
+
+	var gotRoles []AssumeRoleProfile
+	if rs, ok := s.(AssumeRoleSource); ok {
+		gotRoles, err = rs.GetAssumeRoleProfiles(ctx)
+		if err != nil {
+			return sourceResult{}, err
+		}
+	}
+
+	return sourceResult{Profiles: got, AssumeRoleProfiles: gotRoles}, nil
 }
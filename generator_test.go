@@ -3,6 +3,7 @@ package awsconfigfile
 import (
 	"bytes"
 	"context"
+	"errors"
 	"strings"
 	"testing"
 
@@ -13,17 +14,23 @@ import (
 // testSource implements the Source interface
 // and provides mock AWS profiles
 type testSource struct {
-	Profiles []SSOProfile
+	Profiles           []SSOProfile
+	AssumeRoleProfiles []AssumeRoleProfile
 }
 
 func (s testSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
 	return s.Profiles, nil
 }
 
+func (s testSource) GetAssumeRoleProfiles(ctx context.Context) ([]AssumeRoleProfile, error) {
+	return s.AssumeRoleProfiles, nil
+}
+
 func TestGenerator_Generate(t *testing.T) {
 	tests := []struct {
 		name                string
 		profiles            []SSOProfile
+		roleProfiles        []AssumeRoleProfile
 		config              string
 		noCredentialProcess bool
 		sectionNameTemplate string
@@ -262,6 +269,43 @@ granted_sso_role_name      = DevRoleTwo
 common_fate_generated_from = aws-sso
 credential_process         = granted credential-process --profile prod/DevRoleTwo
 region                     = us-west-2
+`,
+		},
+		{
+			name: "assume role profiles",
+			profiles: []SSOProfile{
+				{
+					SSOStartURL:   "https://example.awsapps.com/start",
+					SSORegion:     "ap-southeast-2",
+					AccountID:     "123456789012",
+					AccountName:   "tooling",
+					RoleName:      "DevRole",
+					GeneratedFrom: "aws-sso",
+				},
+			},
+			roleProfiles: []AssumeRoleProfile{
+				{
+					AccountID:     "210987654321",
+					AccountName:   "workload",
+					RoleName:      "Deploy",
+					SourceProfile: "myprefix-tooling/DevRole",
+					GeneratedFrom: "aws-sso",
+				},
+			},
+			prefix: "myprefix-",
+			want: `
+[profile myprefix-tooling/DevRole]
+granted_sso_start_url      = https://example.awsapps.com/start
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 123456789012
+granted_sso_role_name      = DevRole
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile myprefix-tooling/DevRole
+
+[profile myprefix-workload/Deploy]
+role_arn                   = arn:aws:iam::210987654321:role/Deploy
+source_profile             = myprefix-tooling/DevRole
+common_fate_generated_from = aws-sso
 `,
 		},
 	}
@@ -276,7 +320,7 @@ region                     = us-west-2
 			}
 
 			g := &Generator{
-				Sources:             []Source{testSource{Profiles: tt.profiles}},
+				Sources:             []Source{testSource{Profiles: tt.profiles, AssumeRoleProfiles: tt.roleProfiles}},
 				Config:              cfg,
 				NoCredentialProcess: tt.noCredentialProcess,
 				ProfileNameTemplate: tt.sectionNameTemplate,
@@ -299,3 +343,144 @@ region                     = us-west-2
 		})
 	}
 }
+
+// failingSource implements the Source interface
+// and always returns an error.
+type failingSource struct {
+	startURLs []string
+}
+
+func (s failingSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	return nil, errors.New("service unavailable")
+}
+
+func (s failingSource) Name() string {
+	return "failing"
+}
+
+// startURLFailingSource is a failingSource which implements StartURLSource.
+type startURLFailingSource struct {
+	failingSource
+}
+
+func (s startURLFailingSource) StartURLs() []string {
+	return s.startURLs
+}
+
+func TestGenerator_ContinueOnSourceError(t *testing.T) {
+	config := `
+[profile failed/DevRole]
+common_fate_generated_from = aws-sso
+granted_sso_start_url      = https://failed.awsapps.com/start
+
+[profile stale/DevRole]
+common_fate_generated_from = aws-sso
+granted_sso_start_url      = https://example.awsapps.com/start
+`
+	ok := testSource{Profiles: []SSOProfile{
+		{
+			SSOStartURL:   "https://example.awsapps.com/start",
+			SSORegion:     "ap-southeast-2",
+			AccountID:     "123456789012",
+			AccountName:   "prod",
+			RoleName:      "DevRole",
+			GeneratedFrom: "aws-sso",
+		},
+	}}
+	pruneStartURLs := []string{"https://example.awsapps.com/start", "https://failed.awsapps.com/start"}
+
+	tests := []struct {
+		name                  string
+		failed                Source
+		continueOnSourceError bool
+		wantPartial           *PartialFailureError
+		want                  string
+	}{
+		{
+			name:   "fails by default",
+			failed: failingSource{},
+			want:   config,
+		},
+		{
+			name:                  "skips pruning for failed start urls",
+			failed:                startURLFailingSource{failingSource{startURLs: []string{"https://failed.awsapps.com/start"}}},
+			continueOnSourceError: true,
+			wantPartial: &PartialFailureError{
+				Errors:                []*SourceError{{Source: "failing", Err: errors.New("service unavailable")}},
+				SkippedPruneStartURLs: []string{"https://failed.awsapps.com/start"},
+			},
+			want: `
+[profile failed/DevRole]
+common_fate_generated_from = aws-sso
+granted_sso_start_url      = https://failed.awsapps.com/start
+
+[profile prod/DevRole]
+granted_sso_start_url      = https://example.awsapps.com/start
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 123456789012
+granted_sso_role_name      = DevRole
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile prod/DevRole
+`,
+		},
+		{
+			name:                  "skips all pruning if the failed start urls are unknown",
+			failed:                failingSource{},
+			continueOnSourceError: true,
+			wantPartial: &PartialFailureError{
+				Errors:                []*SourceError{{Source: "failing", Err: errors.New("service unavailable")}},
+				PruningSkipped:        true,
+				SkippedPruneStartURLs: pruneStartURLs,
+			},
+			want: `
+[profile failed/DevRole]
+common_fate_generated_from = aws-sso
+granted_sso_start_url      = https://failed.awsapps.com/start
+
+[profile stale/DevRole]
+common_fate_generated_from = aws-sso
+granted_sso_start_url      = https://example.awsapps.com/start
+
+[profile prod/DevRole]
+granted_sso_start_url      = https://example.awsapps.com/start
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 123456789012
+granted_sso_role_name      = DevRole
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile prod/DevRole
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ini.Load([]byte(config))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			g := &Generator{
+				Sources:               []Source{ok, tt.failed},
+				Config:                cfg,
+				PruneStartURLs:        pruneStartURLs,
+				ContinueOnSourceError: tt.continueOnSourceError,
+			}
+			err = g.Generate(context.Background())
+
+			if tt.wantPartial != nil {
+				var partialErr *PartialFailureError
+				assert.True(t, errors.As(err, &partialErr), "expected a *PartialFailureError, got %v", err)
+				assert.Equal(t, tt.wantPartial, partialErr)
+			} else {
+				var srcErr *SourceError
+				assert.True(t, errors.As(err, &srcErr), "expected a *SourceError, got %v", err)
+			}
+
+			var output bytes.Buffer
+			_, err = cfg.WriteTo(&output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, strings.TrimSpace(tt.want), strings.TrimSpace(output.String()))
+		})
+	}
+}
@@ -3,6 +3,7 @@ module github.com/common-fate/awsconfigfile
 go 1.19
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/Masterminds/sprig/v3 v3.2.3
 	gopkg.in/ini.v1 v1.67.0
 )
@@ -22,8 +23,8 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.8.1
 	golang.org/x/sync v0.1.0
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,298 @@
+package awsconfigfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// IdentityCenterSource loads a profile for every account and role that the user
+// can access in AWS IAM Identity Center (AWS SSO).
+//
+// It uses the access token cached by 'aws sso login' or 'granted sso login'
+// and calls the sso:ListAccounts and sso:ListAccountRoles APIs.
+type IdentityCenterSource struct {
+	// StartURL is the AWS access portal URL, such as 'https://example.awsapps.com/start'.
+	StartURL string
+	// SSORegion is the region of the IAM Identity Center instance.
+	SSORegion string
+	// Region is written to the region key of the generated profiles, if set.
+	Region string
+
+	// CacheDir is the directory containing cached SSO access tokens.
+	// Defaults to ~/.aws/sso/cache.
+	CacheDir string
+	// Endpoint overrides the SSO portal API endpoint,
+	// which defaults to 'https://portal.sso.<SSORegion>.amazonaws.com'.
+	Endpoint string
+	// HTTPClient is used to call the SSO portal API.
+	// Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// identityCenterConcurrency is the number of accounts to list roles for at once.
+const identityCenterConcurrency = 5
+
+// Name implements NamedSource.
+func (s *IdentityCenterSource) Name() string {
+	return "aws-sso:" + s.StartURL
+}
+
+// StartURLs implements StartURLSource.
+func (s *IdentityCenterSource) StartURLs() []string {
+	return []string{s.StartURL}
+}
+
+// GetProfiles implements Source.
+func (s *IdentityCenterSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	token, err := s.accessToken(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := s.listAccounts(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// roles are stored by account index so that profiles are returned in the same order as the accounts.
+	roles := make([][]ssoRole, len(accounts))
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(identityCenterConcurrency)
+
+	for i, account := range accounts {
+		i, account := i, account
+		eg.Go(func() error {
+			got, err := s.listAccountRoles(ctx, token, account.AccountID)
+			if err != nil {
+				return err
+			}
+			roles[i] = got
+			return nil
+		})
+	}
+
+	err = eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []SSOProfile
+	for i, account := range accounts {
+		for _, role := range roles[i] {
+			profiles = append(profiles, SSOProfile{
+				SSOStartURL:   s.StartURL,
+				SSORegion:     s.SSORegion,
+				Region:        s.Region,
+				AccountID:     account.AccountID,
+				AccountName:   account.AccountName,
+				RoleName:      role.RoleName,
+				GeneratedFrom: "aws-sso",
+				Metadata:      accountMetadata(account),
+			})
+		}
+	}
+
+	return profiles, nil
+}
+
+// ssoTokenCacheEntry is a cached SSO access token in ~/.aws/sso/cache.
+type ssoTokenCacheEntry struct {
+	StartURL    string `json:"startUrl"`
+	Region      string `json:"region"`
+	AccessToken string `json:"accessToken"`
+	ExpiresAt   string `json:"expiresAt"`
+}
+
+// accessToken finds the cached SSO access token for the start URL
+// which expires last, ignoring any expired tokens.
+func (s *IdentityCenterSource) accessToken(now time.Time) (string, error) {
+	dir := s.CacheDir
+	if dir == "" {
+		dir = filepath.Join(userHomeDir(), ".aws", "sso", "cache")
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return "", err
+	}
+
+	var token string
+	var expiry time.Time
+
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+
+		var entry ssoTokenCacheEntry
+		// other files in the cache, such as client registrations, are ignored.
+		if json.Unmarshal(data, &entry) != nil || entry.AccessToken == "" {
+			continue
+		}
+		if strings.TrimSuffix(entry.StartURL, "/") != strings.TrimSuffix(s.StartURL, "/") {
+			continue
+		}
+
+		expiresAt, err := parseSSOExpiry(entry.ExpiresAt)
+		if err != nil || !expiresAt.After(now) {
+			continue
+		}
+		if expiresAt.After(expiry) {
+			token = entry.AccessToken
+			expiry = expiresAt
+		}
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("no valid SSO access token was found for %s in %s: run 'aws sso login' to sign in", s.StartURL, dir)
+	}
+	return token, nil
+}
+
+// parseSSOExpiry parses the expiresAt field of a cached SSO access token.
+// Older versions of the AWS CLI write the time zone as 'UTC' rather than 'Z'.
+func parseSSOExpiry(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02T15:04:05UTC", s)
+}
+
+type ssoAccount struct {
+	AccountID    string `json:"accountId"`
+	AccountName  string `json:"accountName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// accountMetadata returns the metadata for the profiles in an account.
+func accountMetadata(account ssoAccount) Metadata {
+	if account.EmailAddress == "" {
+		return nil
+	}
+	return Metadata{MetadataAccountEmail: account.EmailAddress}
+}
+
+type ssoRole struct {
+	AccountID string `json:"accountId"`
+	RoleName  string `json:"roleName"`
+}
+
+func (s *IdentityCenterSource) listAccounts(ctx context.Context, token string) ([]ssoAccount, error) {
+	var accounts []ssoAccount
+	var nextToken string
+
+	for {
+		var res struct {
+			AccountList []ssoAccount `json:"accountList"`
+			NextToken   string       `json:"nextToken"`
+		}
+
+		query := url.Values{"max_result": {"100"}}
+		if nextToken != "" {
+			query.Set("next_token", nextToken)
+		}
+
+		err := s.get(ctx, token, "/assignment/accounts", query, &res)
+		if err != nil {
+			return nil, fmt.Errorf("listing accounts: %w", err)
+		}
+
+		accounts = append(accounts, res.AccountList...)
+		if res.NextToken == "" {
+			return accounts, nil
+		}
+		nextToken = res.NextToken
+	}
+}
+
+func (s *IdentityCenterSource) listAccountRoles(ctx context.Context, token string, accountID string) ([]ssoRole, error) {
+	var roles []ssoRole
+	var nextToken string
+
+	for {
+		var res struct {
+			RoleList  []ssoRole `json:"roleList"`
+			NextToken string    `json:"nextToken"`
+		}
+
+		query := url.Values{"account_id": {accountID}, "max_result": {"100"}}
+		if nextToken != "" {
+			query.Set("next_token", nextToken)
+		}
+
+		err := s.get(ctx, token, "/assignment/roles", query, &res)
+		if err != nil {
+			return nil, fmt.Errorf("listing roles for account %s: %w", accountID, err)
+		}
+
+		roles = append(roles, res.RoleList...)
+		if res.NextToken == "" {
+			return roles, nil
+		}
+		nextToken = res.NextToken
+	}
+}
+
+// errSSOUnauthorized is returned if the SSO access token is rejected.
+var errSSOUnauthorized = errors.New("the SSO access token is invalid or expired: run 'aws sso login' to sign in again")
+
+// get calls the SSO portal API and decodes the JSON response into out.
+func (s *IdentityCenterSource) get(ctx context.Context, token string, path string, query url.Values, out any) error {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://portal.sso.%s.amazonaws.com", s.SSORegion)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-amz-sso_bearer_token", token)
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return httpStatusError(res.StatusCode, body, errSSOUnauthorized)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// httpStatusError returns an error for an unsuccessful HTTP response.
+// Throttling and server errors are marked as retryable, and
+// unauthorizedErr is returned for 401 and 403 responses.
+func httpStatusError(status int, body []byte, unauthorizedErr error) error {
+	err := fmt.Errorf("unexpected HTTP status %d: %s", status, strings.TrimSpace(string(body)))
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return unauthorizedErr
+	case status == http.StatusTooManyRequests || status >= 500:
+		return RetryableError(err)
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package awsconfigfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeSSOToken(t *testing.T, dir, name string, entry ssoTokenCacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, name), data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeSSOPortal is a fake AWS SSO portal API which returns two pages of results.
+func fakeSSOPortal(t *testing.T, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-amz-sso_bearer_token") != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var res any
+		switch r.URL.Path {
+		case "/assignment/accounts":
+			if r.URL.Query().Get("next_token") == "" {
+				res = map[string]any{
+					"accountList": []ssoAccount{{AccountID: "111111111111", AccountName: "prod", EmailAddress: "prod@example.com"}},
+					"nextToken":   "page2",
+				}
+			} else {
+				res = map[string]any{
+					"accountList": []ssoAccount{{AccountID: "222222222222", AccountName: "dev", EmailAddress: "dev@example.com"}},
+				}
+			}
+		case "/assignment/roles":
+			accountID := r.URL.Query().Get("account_id")
+			if r.URL.Query().Get("next_token") == "" {
+				res = map[string]any{
+					"roleList":  []ssoRole{{AccountID: accountID, RoleName: "AdministratorAccess"}},
+					"nextToken": "page2",
+				}
+			} else {
+				res = map[string]any{
+					"roleList": []ssoRole{{AccountID: accountID, RoleName: "ReadOnly"}},
+				}
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		err := json.NewEncoder(w).Encode(res)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+}
+
+func TestIdentityCenterSource_GetProfiles(t *testing.T) {
+	dir := t.TempDir()
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	writeSSOToken(t, dir, "expired.json", ssoTokenCacheEntry{StartURL: "https://example.awsapps.com/start", AccessToken: "expired", ExpiresAt: past})
+	writeSSOToken(t, dir, "other.json", ssoTokenCacheEntry{StartURL: "https://other.awsapps.com/start", AccessToken: "other", ExpiresAt: future})
+	writeSSOToken(t, dir, "valid.json", ssoTokenCacheEntry{StartURL: "https://example.awsapps.com/start/", AccessToken: "valid", ExpiresAt: future})
+
+	server := fakeSSOPortal(t, "valid")
+	defer server.Close()
+
+	s := &IdentityCenterSource{
+		StartURL:  "https://example.awsapps.com/start",
+		SSORegion: "ap-southeast-2",
+		Region:    "us-west-2",
+		CacheDir:  dir,
+		Endpoint:  server.URL,
+	}
+
+	got, err := s.GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := func(accountID, accountName, roleName string) SSOProfile {
+		return SSOProfile{
+			SSOStartURL:   "https://example.awsapps.com/start",
+			SSORegion:     "ap-southeast-2",
+			Region:        "us-west-2",
+			AccountID:     accountID,
+			AccountName:   accountName,
+			RoleName:      roleName,
+			GeneratedFrom: "aws-sso",
+			Metadata:      Metadata{MetadataAccountEmail: accountName + "@example.com"},
+		}
+	}
+
+	assert.Equal(t, []SSOProfile{
+		profile("111111111111", "prod", "AdministratorAccess"),
+		profile("111111111111", "prod", "ReadOnly"),
+		profile("222222222222", "dev", "AdministratorAccess"),
+		profile("222222222222", "dev", "ReadOnly"),
+	}, got)
+}
+
+func TestIdentityCenterSource_NoToken(t *testing.T) {
+	s := &IdentityCenterSource{
+		StartURL:  "https://example.awsapps.com/start",
+		SSORegion: "ap-southeast-2",
+		CacheDir:  t.TempDir(),
+	}
+
+	_, err := s.GetProfiles(context.Background())
+	assert.ErrorContains(t, err, "no valid SSO access token was found")
+}
+
+func TestIdentityCenterSource_Errors(t *testing.T) {
+	dir := t.TempDir()
+	writeSSOToken(t, dir, "token.json", ssoTokenCacheEntry{
+		StartURL:    "https://example.awsapps.com/start",
+		AccessToken: "token",
+		ExpiresAt:   time.Now().Add(time.Hour).UTC().Format("2006-01-02T15:04:05UTC"),
+	})
+
+	tests := []struct {
+		name          string
+		status        int
+		wantRetryable bool
+		wantErr       error
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, wantErr: errSSOUnauthorized},
+		{name: "throttled", status: http.StatusTooManyRequests, wantRetryable: true},
+		{name: "server error", status: http.StatusInternalServerError, wantRetryable: true},
+		{name: "bad request", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			s := &IdentityCenterSource{
+				StartURL:  "https://example.awsapps.com/start",
+				SSORegion: "ap-southeast-2",
+				CacheDir:  dir,
+				Endpoint:  server.URL,
+			}
+
+			_, err := s.GetProfiles(context.Background())
+			assert.Error(t, err)
+			assert.Equal(t, tt.wantRetryable, IsRetryable(err))
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package awsconfigfile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// IniSource loads the SSO profiles from an existing AWS config file,
+// so that hand-maintained profiles can be migrated to generated ones.
+//
+// Profiles configured in any of these ways are recognised:
+//
+//   - sso_start_url, sso_region, sso_account_id and sso_role_name
+//   - granted_sso_start_url, granted_sso_region, granted_sso_account_id and granted_sso_role_name
+//   - sso_session, sso_account_id and sso_role_name, with the start URL and region read
+//     from the [sso-session] section
+//
+// The profile name is used as the account name of the returned profiles.
+// Profiles which were generated by this package are skipped.
+type IniSource struct {
+	// Config is the config file to import profiles from.
+	// If nil, the config file is loaded from Path.
+	Config *ini.File
+	// Path is the config file to import profiles from if Config is nil.
+	// Defaults to the path returned by ResolveSharedConfigFilename.
+	Path string
+	// GeneratedFrom is written to common_fate_generated_from in the generated profiles.
+	// Defaults to 'import'.
+	GeneratedFrom string
+}
+
+// Name implements NamedSource.
+func (s *IniSource) Name() string {
+	if s.Config != nil && s.Path == "" {
+		return "ini"
+	}
+	return "ini:" + s.path()
+}
+
+func (s *IniSource) path() string {
+	if s.Path == "" {
+		return ResolveSharedConfigFilename().Path
+	}
+	return s.Path
+}
+
+// GetProfiles implements Source.
+func (s *IniSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	config := s.Config
+	if config == nil {
+		cfg, err := LoadConfig(s.path())
+		if err != nil {
+			return nil, err
+		}
+		config = cfg.File
+	}
+
+	generatedFrom := s.GeneratedFrom
+	if generatedFrom == "" {
+		generatedFrom = "import"
+	}
+
+	var profiles []SSOProfile
+	var errs []string
+
+	for _, sec := range config.Sections() {
+		profileName, ok := cutPrefix(sec.Name(), "profile ")
+		if !ok {
+			if sec.Name() != "default" {
+				continue
+			}
+			profileName = "default"
+		}
+		if sec.HasKey("common_fate_generated_from") {
+			continue
+		}
+
+		p, ok, err := importProfile(config, sec)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("profile %s: %s", profileName, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		p.AccountName = profileName
+		p.GeneratedFrom = generatedFrom
+		profiles = append(profiles, p)
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("importing profiles: %s", strings.Join(errs, "; "))
+	}
+	return profiles, nil
+}
+
+// importProfile reads an SSO profile from a config section.
+// ok is false if the section is not an SSO profile, such as a profile with static credentials
+// or a profile which only references an sso_session for 'aws sso login'.
+func importProfile(config *ini.File, sec *ini.Section) (p SSOProfile, ok bool, err error) {
+	value := func(key string) string {
+		return strings.TrimSpace(sec.Key(key).String())
+	}
+
+	p.Region = value("region")
+
+	switch {
+	case sec.HasKey("granted_sso_account_id") || sec.HasKey("granted_sso_role_name"):
+		p.SSOStartURL = value("granted_sso_start_url")
+		p.SSORegion = value("granted_sso_region")
+		p.AccountID = value("granted_sso_account_id")
+		p.RoleName = value("granted_sso_role_name")
+		p.CommonFateURL = credentialProcessURL(value("credential_process"))
+
+	case sec.HasKey("sso_account_id") || sec.HasKey("sso_role_name"):
+		p.AccountID = value("sso_account_id")
+		p.RoleName = value("sso_role_name")
+
+		if sec.HasKey("sso_session") {
+			name := value("sso_session")
+			session, err := config.GetSection("sso-session " + name)
+			if err != nil {
+				return SSOProfile{}, false, fmt.Errorf("sso-session %s does not exist", name)
+			}
+			p.SSOStartURL = strings.TrimSpace(session.Key("sso_start_url").String())
+			p.SSORegion = strings.TrimSpace(session.Key("sso_region").String())
+		} else {
+			p.SSOStartURL = value("sso_start_url")
+			p.SSORegion = value("sso_region")
+		}
+
+	default:
+		return SSOProfile{}, false, nil
+	}
+
+	var missing []string
+	if p.SSOStartURL == "" {
+		missing = append(missing, "start URL")
+	}
+	if p.SSORegion == "" {
+		missing = append(missing, "SSO region")
+	}
+	if p.AccountID == "" {
+		missing = append(missing, "account ID")
+	}
+	if p.RoleName == "" {
+		missing = append(missing, "role name")
+	}
+	if len(missing) > 0 {
+		return SSOProfile{}, false, fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+
+	return p, true, nil
+}
+
+// credentialProcessURL returns the value of the --url flag
+// in a 'granted credential-process' command, if there is one.
+func credentialProcessURL(command string) string {
+	fields := strings.Fields(command)
+	for i, f := range fields {
+		if f == "--url" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+		if u, ok := cutPrefix(f, "--url="); ok {
+			return u
+		}
+	}
+	return ""
+}
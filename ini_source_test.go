@@ -0,0 +1,159 @@
+package awsconfigfile
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/ini.v1"
+)
+
+func TestIniSource_GetProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    []SSOProfile
+		wantErr string
+	}{
+		{
+			name: "legacy sso profile",
+			config: `
+[profile prod]
+sso_start_url = https://example.awsapps.com/start
+sso_region = ap-southeast-2
+sso_account_id = 123456789012
+sso_role_name = DevRole
+region = us-west-2
+`,
+			want: []SSOProfile{{
+				SSOStartURL:   "https://example.awsapps.com/start",
+				SSORegion:     "ap-southeast-2",
+				AccountID:     "123456789012",
+				AccountName:   "prod",
+				RoleName:      "DevRole",
+				Region:        "us-west-2",
+				GeneratedFrom: "import",
+			}},
+		},
+		{
+			name: "granted credential process profile",
+			config: `
+[default]
+granted_sso_start_url = https://example.awsapps.com/start
+granted_sso_region = ap-southeast-2
+granted_sso_account_id = 123456789012
+granted_sso_role_name = DevRole
+credential_process = granted credential-process --profile default --url https://commonfate.example.com
+`,
+			want: []SSOProfile{{
+				SSOStartURL:   "https://example.awsapps.com/start",
+				SSORegion:     "ap-southeast-2",
+				AccountID:     "123456789012",
+				AccountName:   "default",
+				RoleName:      "DevRole",
+				CommonFateURL: "https://commonfate.example.com",
+				GeneratedFrom: "import",
+			}},
+		},
+		{
+			name: "sso session profile",
+			config: `
+[sso-session example]
+sso_start_url = https://example.awsapps.com/start
+sso_region = ap-southeast-2
+
+[profile login]
+sso_session = example
+
+[profile dev]
+sso_session = example
+sso_account_id = 123456789012
+sso_role_name = DevRole
+`,
+			want: []SSOProfile{{
+				SSOStartURL:   "https://example.awsapps.com/start",
+				SSORegion:     "ap-southeast-2",
+				AccountID:     "123456789012",
+				AccountName:   "dev",
+				RoleName:      "DevRole",
+				GeneratedFrom: "import",
+			}},
+		},
+		{
+			name: "other profiles are skipped",
+			config: `
+[profile static]
+aws_access_key_id = AKIAEXAMPLE
+
+[profile generated]
+sso_start_url = https://example.awsapps.com/start
+sso_region = ap-southeast-2
+sso_account_id = 123456789012
+sso_role_name = DevRole
+common_fate_generated_from = aws-sso
+
+[services example]
+sso_account_id = 123456789012
+`,
+		},
+		{
+			name: "incomplete profiles",
+			config: `
+[profile missing-session]
+sso_session = missing
+sso_account_id = 123456789012
+sso_role_name = DevRole
+
+[profile missing-role]
+sso_start_url = https://example.awsapps.com/start
+sso_region = ap-southeast-2
+sso_account_id = 123456789012
+`,
+			wantErr: "importing profiles: profile missing-role: missing role name; profile missing-session: sso-session missing does not exist",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ini.Load([]byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := IniSource{Config: cfg}
+			got, err := s.GetProfiles(context.Background())
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIniSource_Path(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "config", `
+[profile prod]
+sso_start_url = https://example.awsapps.com/start
+sso_region = ap-southeast-2
+sso_account_id = 123456789012
+sso_role_name = DevRole
+`)
+
+	s := IniSource{Path: path}
+	got, err := s.GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, got, 1)
+	assert.Equal(t, "ini:"+path, s.Name())
+
+	// a missing file has no profiles to import
+	s = IniSource{Path: filepath.Join(t.TempDir(), "missing")}
+	got, err = s.GetProfiles(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+}
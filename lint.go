@@ -0,0 +1,275 @@
+package awsconfigfile
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// Severity is how serious a lint finding is.
+type Severity string
+
+const (
+	// SeverityError findings cause AWS tools to fail when the profile is used.
+	SeverityError Severity = "error"
+	// SeverityWarning findings may be intentional, such as a source_profile
+	// which is defined in ~/.aws/credentials rather than the config file.
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem found by Lint.
+type Finding struct {
+	Severity Severity
+	// Section is the name of the config section, such as 'profile prod/Admin'.
+	Section string
+	// Key is the key that the finding applies to,
+	// or empty if it applies to the whole section.
+	Key     string
+	Message string
+}
+
+func (f Finding) String() string {
+	if f.Key == "" {
+		return fmt.Sprintf("%s: [%s]: %s", f.Severity, f.Section, f.Message)
+	}
+	return fmt.Sprintf("%s: [%s] %s: %s", f.Severity, f.Section, f.Key, f.Message)
+}
+
+// LintError is returned by Merge if MergeOpts.Lint is true
+// and the merged config file has findings with SeverityError.
+type LintError struct {
+	Findings []Finding
+}
+
+func (e *LintError) Error() string {
+	var msgs []string
+	for _, f := range e.Findings {
+		msgs = append(msgs, f.String())
+	}
+	return "config file has errors: " + strings.Join(msgs, "; ")
+}
+
+// Lint checks a config file for problems which cause AWS tools to fail,
+// such as source_profile cycles, SSO profiles with missing keys and invalid account IDs.
+// Both generated and hand-written profiles are checked.
+//
+// Findings are returned in the order of the sections in the config file.
+func Lint(config *ini.File) []Finding {
+	l := linter{config: config, reportedCycles: map[string]bool{}}
+
+	for _, sec := range config.Sections() {
+		name := sec.Name()
+		switch {
+		case name == "default" || strings.HasPrefix(name, "profile "):
+			l.lintProfile(sec)
+		case strings.HasPrefix(name, "sso-session "):
+			l.lintSSOSession(sec)
+		}
+	}
+
+	return l.findings
+}
+
+type linter struct {
+	config   *ini.File
+	findings []Finding
+	// reportedCycles is the profiles in source_profile cycles which have been reported,
+	// so that each cycle is only reported once.
+	reportedCycles map[string]bool
+}
+
+func (l *linter) add(severity Severity, sec *ini.Section, key string, format string, args ...any) {
+	l.findings = append(l.findings, Finding{
+		Severity: severity,
+		Section:  sec.Name(),
+		Key:      key,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) lintProfile(sec *ini.Section) {
+	if sec.Name() == "profile default" && l.config.HasSection("default") {
+		l.add(SeverityWarning, sec, "", "both [default] and [profile default] are defined, and AWS tools disagree on which is used")
+	}
+
+	for _, key := range []string{"region", "sso_region", "granted_sso_region"} {
+		l.lintRegion(sec, key)
+	}
+	for _, key := range []string{"sso_account_id", "granted_sso_account_id"} {
+		if sec.HasKey(key) && !isValidAccountID(keyValue(sec, key)) {
+			l.add(SeverityError, sec, key, "account ID %q must be 12 digits", keyValue(sec, key))
+		}
+	}
+	if sec.HasKey("role_arn") {
+		l.lintRoleARN(sec)
+	}
+
+	l.lintSSO(sec)
+	l.lintSourceProfile(sec)
+}
+
+func (l *linter) lintSSOSession(sec *ini.Section) {
+	for _, key := range []string{"sso_start_url", "sso_region"} {
+		if keyValue(sec, key) == "" {
+			l.add(SeverityError, sec, "", "%s is required", key)
+		}
+	}
+	l.lintRegion(sec, "sso_region")
+}
+
+// lintSSO checks that SSO profiles have the keys needed to sign in.
+func (l *linter) lintSSO(sec *ini.Section) {
+	if sec.HasKey("sso_account_id") || sec.HasKey("sso_role_name") {
+		required := []string{"sso_account_id", "sso_role_name"}
+
+		if session := keyValue(sec, "sso_session"); session != "" {
+			if !l.config.HasSection("sso-session " + session) {
+				l.add(SeverityError, sec, "sso_session", "sso-session %q does not exist", session)
+			}
+		} else {
+			required = append(required, "sso_start_url", "sso_region")
+		}
+
+		for _, key := range required {
+			if keyValue(sec, key) == "" {
+				l.add(SeverityError, sec, "", "SSO profile is missing %s", key)
+			}
+		}
+	}
+
+	if sec.HasKey("granted_sso_start_url") {
+		for _, key := range []string{"granted_sso_region", "granted_sso_account_id", "granted_sso_role_name"} {
+			if keyValue(sec, key) == "" {
+				l.add(SeverityError, sec, "", "Granted SSO profile is missing %s", key)
+			}
+		}
+	}
+}
+
+func (l *linter) lintRegion(sec *ini.Section, key string) {
+	if !sec.HasKey(key) {
+		return
+	}
+	region := keyValue(sec, key)
+	switch {
+	case region == "":
+		l.add(SeverityError, sec, key, "region is empty")
+	case !isValidRegionName(region):
+		l.add(SeverityError, sec, key, "%q is not a valid region name", region)
+	case !IsKnownRegion(region):
+		l.add(SeverityWarning, sec, key, "%q is not a known region", region)
+	}
+}
+
+// lintRoleARN checks that role_arn is an IAM role ARN, such as 'arn:aws:iam::123456789012:role/Admin'.
+func (l *linter) lintRoleARN(sec *ini.Section) {
+	arn := keyValue(sec, "role_arn")
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "iam" || !strings.HasPrefix(parts[5], "role/") {
+		l.add(SeverityError, sec, "role_arn", "%q is not an IAM role ARN", arn)
+		return
+	}
+	if !isValidAccountID(parts[4]) {
+		l.add(SeverityError, sec, "role_arn", "account ID %q must be 12 digits", parts[4])
+	}
+}
+
+// lintSourceProfile checks that the source_profile exists and the role chain doesn't contain a cycle.
+func (l *linter) lintSourceProfile(sec *ini.Section) {
+	source := keyValue(sec, "source_profile")
+	if source == "" {
+		return
+	}
+
+	if profileSection(l.config, source) == nil {
+		l.add(SeverityWarning, sec, "source_profile", "profile %q does not exist in the config file", source)
+		return
+	}
+
+	profile := strings.TrimPrefix(sec.Name(), "profile ")
+	if source == profile {
+		// a profile may use its own static credentials to assume a role.
+		if !sec.HasKey("aws_access_key_id") {
+			l.add(SeverityError, sec, "source_profile", "profile uses itself as its source_profile, but has no aws_access_key_id")
+		}
+		return
+	}
+
+	cycle := l.sourceProfileCycle(profile)
+	if cycle == nil || l.reportedCycles[profile] {
+		return
+	}
+	for _, p := range cycle {
+		l.reportedCycles[p] = true
+	}
+	l.add(SeverityError, sec, "source_profile", "role chain contains a cycle: %s", strings.Join(append(cycle, cycle[0]), " -> "))
+}
+
+// sourceProfileCycle follows the source_profile of each profile starting with profile,
+// returning the profiles in the cycle if profile is part of one.
+func (l *linter) sourceProfileCycle(profile string) []string {
+	var chain []string
+	seen := map[string]bool{}
+
+	for p := profile; p != ""; {
+		if seen[p] {
+			if p != profile {
+				// the chain leads to a cycle which profile is not part of.
+				return nil
+			}
+			return chain
+		}
+		seen[p] = true
+		chain = append(chain, p)
+
+		sec := profileSection(l.config, p)
+		if sec == nil {
+			return nil
+		}
+		next := keyValue(sec, "source_profile")
+		// a profile using itself ends the chain, as it has static credentials.
+		if next == p {
+			return nil
+		}
+		p = next
+	}
+	return nil
+}
+
+// keyValue returns the value of a key, or an empty string if the section doesn't have the key.
+// Unlike Section.Key, the key is not created if it doesn't exist.
+func keyValue(sec *ini.Section, key string) string {
+	if !sec.HasKey(key) {
+		return ""
+	}
+	return sec.Key(key).String()
+}
+
+// isValidAccountID returns true if id is a 12 digit AWS account ID.
+func isValidAccountID(id string) bool {
+	if len(id) != 12 {
+		return false
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// lintMerged lints a merged config file, returning a *LintError
+// if there are any findings with SeverityError.
+func lintMerged(config *ini.File) error {
+	var errs []Finding
+	for _, f := range Lint(config) {
+		if f.Severity == SeverityError {
+			errs = append(errs, f)
+		}
+	}
+	if len(errs) > 0 {
+		return &LintError{Findings: errs}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []Finding
+	}{
+		{
+			name: "valid",
+			config: `
+[default]
+region = us-east-1
+
+[profile prod/Admin]
+sso_start_url  = https://example.awsapps.com/start
+sso_region     = ap-southeast-2
+sso_account_id = 123456789012
+sso_role_name  = Admin
+
+[profile dev/Admin]
+sso_session    = example
+sso_account_id = 210987654321
+sso_role_name  = Admin
+
+[sso-session example]
+sso_start_url = https://example.awsapps.com/start
+sso_region    = ap-southeast-2
+
+[profile granted]
+granted_sso_start_url  = https://example.awsapps.com/start
+granted_sso_region     = ap-southeast-2
+granted_sso_account_id = 123456789012
+granted_sso_role_name  = Admin
+credential_process     = granted credential-process --profile granted
+
+[profile deploy]
+role_arn       = arn:aws:iam::123456789012:role/Deploy
+source_profile = prod/Admin
+
+[profile static]
+aws_access_key_id = AKIAEXAMPLE
+role_arn          = arn:aws:iam::123456789012:role/Deploy
+source_profile    = static
+`,
+		},
+		{
+			name: "missing source profile",
+			config: `
+[profile deploy]
+role_arn       = arn:aws:iam::123456789012:role/Deploy
+source_profile = missing
+`,
+			want: []Finding{
+				{Severity: SeverityWarning, Section: "profile deploy", Key: "source_profile", Message: `profile "missing" does not exist in the config file`},
+			},
+		},
+		{
+			name: "default source profile",
+			config: `
+[default]
+region = us-east-1
+
+[profile deploy]
+role_arn       = arn:aws:iam::123456789012:role/Deploy
+source_profile = default
+`,
+		},
+		{
+			name: "role chain cycle is reported once",
+			config: `
+[profile a]
+role_arn       = arn:aws:iam::123456789012:role/A
+source_profile = b
+
+[profile b]
+role_arn       = arn:aws:iam::123456789012:role/B
+source_profile = c
+
+[profile c]
+role_arn       = arn:aws:iam::123456789012:role/C
+source_profile = a
+
+[profile d]
+role_arn       = arn:aws:iam::123456789012:role/D
+source_profile = a
+`,
+			want: []Finding{
+				{Severity: SeverityError, Section: "profile a", Key: "source_profile", Message: "role chain contains a cycle: a -> b -> c -> a"},
+			},
+		},
+		{
+			name: "profile default is used before default",
+			config: `
+[default]
+role_arn       = arn:aws:iam::123456789012:role/Default
+source_profile = a
+
+[profile default]
+aws_access_key_id = AKIAEXAMPLE
+
+[profile a]
+role_arn       = arn:aws:iam::123456789012:role/A
+source_profile = default
+`,
+			// the role chain follows [profile default], as Merge does, so there is no cycle.
+			want: []Finding{
+				{Severity: SeverityWarning, Section: "profile default", Message: "both [default] and [profile default] are defined, and AWS tools disagree on which is used"},
+			},
+		},
+		{
+			name: "source profile is itself without credentials",
+			config: `
+[profile a]
+role_arn       = arn:aws:iam::123456789012:role/A
+source_profile = a
+`,
+			want: []Finding{
+				{Severity: SeverityError, Section: "profile a", Key: "source_profile", Message: "profile uses itself as its source_profile, but has no aws_access_key_id"},
+			},
+		},
+		{
+			name: "sso profiles with missing keys",
+			config: `
+[profile prod/Admin]
+sso_start_url  = https://example.awsapps.com/start
+sso_account_id = 123456789012
+sso_role_name  = Admin
+
+[profile dev/Admin]
+sso_session    = missing
+sso_account_id = 210987654321
+sso_role_name  = Admin
+
+[profile granted]
+granted_sso_start_url  = https://example.awsapps.com/start
+granted_sso_account_id = 123456789012
+granted_sso_role_name  = Admin
+
+[sso-session example]
+sso_start_url = https://example.awsapps.com/start
+`,
+			want: []Finding{
+				{Severity: SeverityError, Section: "profile prod/Admin", Message: "SSO profile is missing sso_region"},
+				{Severity: SeverityError, Section: "profile dev/Admin", Key: "sso_session", Message: `sso-session "missing" does not exist`},
+				{Severity: SeverityError, Section: "profile granted", Message: "Granted SSO profile is missing granted_sso_region"},
+				{Severity: SeverityError, Section: "sso-session example", Message: "sso_region is required"},
+			},
+		},
+		{
+			name: "duplicate default",
+			config: `
+[default]
+region = us-east-1
+
+[profile default]
+region = us-west-2
+`,
+			want: []Finding{
+				{Severity: SeverityWarning, Section: "profile default", Message: "both [default] and [profile default] are defined, and AWS tools disagree on which is used"},
+			},
+		},
+		{
+			name: "regions",
+			config: `
+[profile a]
+region = us-east
+
+[profile b]
+region = xx-north-9
+
+[profile c]
+sso_start_url  = https://example.awsapps.com/start
+sso_region     = US-EAST-1
+sso_account_id = 123456789012
+sso_role_name  = Admin
+`,
+			want: []Finding{
+				{Severity: SeverityError, Section: "profile a", Key: "region", Message: `"us-east" is not a valid region name`},
+				{Severity: SeverityWarning, Section: "profile b", Key: "region", Message: `"xx-north-9" is not a known region`},
+				{Severity: SeverityError, Section: "profile c", Key: "sso_region", Message: `"US-EAST-1" is not a valid region name`},
+			},
+		},
+		{
+			name: "account IDs",
+			config: `
+[profile a]
+sso_start_url  = https://example.awsapps.com/start
+sso_region     = us-east-1
+sso_account_id = 12345678901
+sso_role_name  = Admin
+
+[profile b]
+role_arn       = arn:aws:iam::12345678901:role/Deploy
+source_profile = a
+
+[profile c]
+role_arn       = Deploy
+source_profile = a
+`,
+			want: []Finding{
+				{Severity: SeverityError, Section: "profile a", Key: "sso_account_id", Message: `account ID "12345678901" must be 12 digits`},
+				{Severity: SeverityError, Section: "profile b", Key: "role_arn", Message: `account ID "12345678901" must be 12 digits`},
+				{Severity: SeverityError, Section: "profile c", Key: "role_arn", Message: `"Deploy" is not an IAM role ARN`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lint(parseIni(t, tt.config))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFinding_String(t *testing.T) {
+	f := Finding{Severity: SeverityError, Section: "profile a", Key: "region", Message: "region is empty"}
+	assert.Equal(t, "error: [profile a] region: region is empty", f.String())
+
+	f.Key = ""
+	assert.Equal(t, "error: [profile a]: region is empty", f.String())
+}
+
+func TestMerge_Lint(t *testing.T) {
+	config := `[profile deploy]
+role_arn       = arn:aws:iam::123456789012:role/Deploy
+source_profile = loop
+
+[profile loop]
+role_arn       = arn:aws:iam::123456789012:role/Loop
+source_profile = deploy
+`
+	profiles := []SSOProfile{{
+		SSOStartURL: "https://example.awsapps.com/start",
+		SSORegion:   "ap-southeast-2",
+		AccountID:   "123456789012",
+		AccountName: "prod",
+		RoleName:    "Admin",
+	}}
+
+	cfg := parseIni(t, config)
+	err := Merge(MergeOpts{Config: cfg, Profiles: profiles, NoCredentialProcess: true, Lint: true})
+
+	var lintErr *LintError
+	if assert.True(t, errors.As(err, &lintErr), err) {
+		assert.Equal(t, []Finding{
+			{Severity: SeverityError, Section: "profile deploy", Key: "source_profile", Message: "role chain contains a cycle: deploy -> loop -> deploy"},
+		}, lintErr.Findings)
+	}
+
+	// the config is not modified
+	var buf bytes.Buffer
+	_, err = cfg.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, buf.String(), "prod/Admin")
+
+	// warnings don't prevent merging
+	cfg = parseIni(t, "[profile b]\nregion = xx-north-9\n")
+	err = Merge(MergeOpts{Config: cfg, Profiles: profiles, NoCredentialProcess: true, Lint: true})
+	assert.NoError(t, err)
+	assert.True(t, cfg.HasSection("profile prod/Admin"))
+}
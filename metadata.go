@@ -0,0 +1,79 @@
+package awsconfigfile
+
+// Well-known Metadata keys.
+const (
+	// MetadataOU is the path of the organizational unit containing the account,
+	// such as 'Root/Workloads/Production'.
+	MetadataOU = "ou"
+	// MetadataAccountEmail is the email address of the account's root user.
+	MetadataAccountEmail = "account_email"
+	// MetadataAccountStatus is the status of the account in AWS Organizations,
+	// such as 'ACTIVE' or 'SUSPENDED'.
+	MetadataAccountStatus = "account_status"
+	// MetadataRoleDescription is the description of the role or permission set.
+	MetadataRoleDescription = "role_description"
+	// MetadataTagPrefix is the prefix of account tags, such as 'tag:environment'.
+	MetadataTagPrefix = "tag:"
+)
+
+// Metadata is additional information about the account and role of a profile,
+// such as account tags and the OU path. Sources may optionally populate it.
+//
+// Metadata is available in profile name templates, such as
+// '{{ .OU }}/{{ .AccountName }}/{{ .RoleName }}' or '{{ .Tag "environment" }}/{{ .AccountName }}'.
+type Metadata map[string]string
+
+// OU returns the path of the organizational unit containing the account.
+func (m Metadata) OU() string {
+	return m[MetadataOU]
+}
+
+// AccountEmail returns the email address of the account's root user.
+func (m Metadata) AccountEmail() string {
+	return m[MetadataAccountEmail]
+}
+
+// RoleDescription returns the description of the role or permission set.
+func (m Metadata) RoleDescription() string {
+	return m[MetadataRoleDescription]
+}
+
+// Tag returns the value of an account tag.
+func (m Metadata) Tag(key string) string {
+	return m[MetadataTagPrefix+key]
+}
+
+// With returns a copy of the metadata with key set to value.
+// The original metadata is not modified, as it may be shared by multiple profiles.
+func (m Metadata) With(key, value string) Metadata {
+	c := make(Metadata, len(m)+1)
+	for k, v := range m {
+		c[k] = v
+	}
+	c[key] = value
+	return c
+}
+
+// OU returns the path of the organizational unit containing the account.
+func (p SSOProfile) OU() string { return p.Metadata.OU() }
+
+// AccountEmail returns the email address of the account's root user.
+func (p SSOProfile) AccountEmail() string { return p.Metadata.AccountEmail() }
+
+// RoleDescription returns the description of the role or permission set.
+func (p SSOProfile) RoleDescription() string { return p.Metadata.RoleDescription() }
+
+// Tag returns the value of an account tag.
+func (p SSOProfile) Tag(key string) string { return p.Metadata.Tag(key) }
+
+// OU returns the path of the organizational unit containing the account.
+func (p AssumeRoleProfile) OU() string { return p.Metadata.OU() }
+
+// AccountEmail returns the email address of the account's root user.
+func (p AssumeRoleProfile) AccountEmail() string { return p.Metadata.AccountEmail() }
+
+// RoleDescription returns the description of the role.
+func (p AssumeRoleProfile) RoleDescription() string { return p.Metadata.RoleDescription() }
+
+// Tag returns the value of an account tag.
+func (p AssumeRoleProfile) Tag(key string) string { return p.Metadata.Tag(key) }
@@ -0,0 +1,438 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// OrganizationsSource adds metadata from AWS Organizations to the profiles
+// returned by another Source, which IAM Identity Center does not return:
+// the OU path, account email, account status and account tags.
+//
+// It must be called with credentials for the organization's management account,
+// or a delegated administrator account. Accounts which are not found
+// in the organization are returned without any additional metadata.
+//
+// Account details are cached in memory for the lifetime of the OrganizationsSource.
+// Wrap it in a CachedSource to cache the enriched profiles between runs.
+type OrganizationsSource struct {
+	Source Source
+	// DropSuspended removes profiles for accounts which are suspended or pending closure.
+	DropSuspended bool
+
+	// Region is the region of the Organizations API. Defaults to 'us-east-1'.
+	Region string
+	// Endpoint overrides the Organizations API endpoint,
+	// which defaults to 'https://organizations.<Region>.amazonaws.com'.
+	Endpoint string
+	// HTTPClient is used to call the Organizations API.
+	// Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Credentials returns the AWS credentials used to call the Organizations API.
+	// Defaults to EnvCredentials.
+	Credentials func(ctx context.Context) (AWSCredentials, error)
+
+	mu sync.Mutex
+	// accounts is the cache of account details by account ID.
+	accounts map[string]*orgAccount
+	// ouNames is the cache of organizational unit names by ID.
+	ouNames map[string]string
+}
+
+// organizationsConcurrency is the number of accounts to describe at once.
+const organizationsConcurrency = 5
+
+// orgAccount is the details of an account in AWS Organizations.
+type orgAccount struct {
+	// found is false if the account is not in the organization.
+	found  bool
+	email  string
+	status string
+	ouPath string
+	tags   map[string]string
+}
+
+// Name implements NamedSource.
+func (s *OrganizationsSource) Name() string {
+	return sourceName(s.Source)
+}
+
+// Unwrap returns the underlying source.
+func (s *OrganizationsSource) Unwrap() Source {
+	return s.Source
+}
+
+// GetProfiles implements Source.
+func (s *OrganizationsSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	profiles, err := s.Source.GetProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(profiles))
+	for i, p := range profiles {
+		ids[i] = p.AccountID
+	}
+	accounts, err := s.describeAccounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var enriched []SSOProfile
+	for _, p := range profiles {
+		a := accounts[p.AccountID]
+		if s.DropSuspended && a.suspended() {
+			continue
+		}
+		p.Metadata = a.metadata(p.Metadata)
+		enriched = append(enriched, p)
+	}
+	return enriched, nil
+}
+
+// GetAssumeRoleProfiles implements AssumeRoleSource.
+func (s *OrganizationsSource) GetAssumeRoleProfiles(ctx context.Context) ([]AssumeRoleProfile, error) {
+	profiles, err := getAssumeRoleProfiles(ctx, s.Source)
+	if err != nil || len(profiles) == 0 {
+		return profiles, err
+	}
+
+	ids := make([]string, len(profiles))
+	for i, p := range profiles {
+		ids[i] = p.AccountID
+	}
+	accounts, err := s.describeAccounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var enriched []AssumeRoleProfile
+	for _, p := range profiles {
+		a := accounts[p.AccountID]
+		if s.DropSuspended && a.suspended() {
+			continue
+		}
+		p.Metadata = a.metadata(p.Metadata)
+		enriched = append(enriched, p)
+	}
+	return enriched, nil
+}
+
+func (a *orgAccount) suspended() bool {
+	return a.found && (a.status == "SUSPENDED" || a.status == "PENDING_CLOSURE")
+}
+
+// metadata returns a copy of m with the account details added.
+func (a *orgAccount) metadata(m Metadata) Metadata {
+	if !a.found {
+		return m
+	}
+	if a.ouPath != "" {
+		m = m.With(MetadataOU, a.ouPath)
+	}
+	if a.email != "" {
+		m = m.With(MetadataAccountEmail, a.email)
+	}
+	if a.status != "" {
+		m = m.With(MetadataAccountStatus, a.status)
+	}
+	for k, v := range a.tags {
+		m = m.With(MetadataTagPrefix+k, v)
+	}
+	return m
+}
+
+// describeAccounts returns the details of the accounts, using the cache if possible.
+func (s *OrganizationsSource) describeAccounts(ctx context.Context, ids []string) (map[string]*orgAccount, error) {
+	s.mu.Lock()
+	if s.accounts == nil {
+		s.accounts = map[string]*orgAccount{}
+		s.ouNames = map[string]string{}
+	}
+	result := map[string]*orgAccount{}
+	var missing []string
+	for _, id := range ids {
+		if _, ok := result[id]; ok {
+			continue
+		}
+		if a, ok := s.accounts[id]; ok {
+			result[id] = a
+			continue
+		}
+		// duplicate IDs are only looked up once.
+		result[id] = nil
+		missing = append(missing, id)
+	}
+	s.mu.Unlock()
+
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	creds, err := s.credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS credentials for AWS Organizations: %w", err)
+	}
+
+	found := make([]*orgAccount, len(missing))
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(organizationsConcurrency)
+
+	for i, id := range missing {
+		i, id := i, id
+		eg.Go(func() error {
+			a, err := s.describeAccount(ctx, creds, id)
+			if err != nil {
+				return fmt.Errorf("describing account %s: %w", id, err)
+			}
+			found[i] = a
+			return nil
+		})
+	}
+
+	err = eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, id := range missing {
+		s.accounts[id] = found[i]
+		result[id] = found[i]
+	}
+	return result, nil
+}
+
+func (s *OrganizationsSource) credentials(ctx context.Context) (AWSCredentials, error) {
+	if s.Credentials != nil {
+		return s.Credentials(ctx)
+	}
+	return EnvCredentials(ctx)
+}
+
+type orgAccountResponse struct {
+	Account struct {
+		ID     string `json:"Id"`
+		Name   string `json:"Name"`
+		Email  string `json:"Email"`
+		Status string `json:"Status"`
+	} `json:"Account"`
+}
+
+type orgParent struct {
+	ID   string `json:"Id"`
+	Type string `json:"Type"`
+}
+
+type orgTag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// describeAccount calls DescribeAccount, ListTagsForResource and ListParents for an account.
+func (s *OrganizationsSource) describeAccount(ctx context.Context, creds AWSCredentials, id string) (*orgAccount, error) {
+	var res orgAccountResponse
+	err := s.call(ctx, creds, "DescribeAccount", map[string]string{"AccountId": id}, &res)
+	var awsErr *awsAPIError
+	if errors.As(err, &awsErr) && awsErr.Type == "AccountNotFoundException" {
+		return &orgAccount{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a := orgAccount{
+		found:  true,
+		email:  res.Account.Email,
+		status: res.Account.Status,
+		tags:   map[string]string{},
+	}
+
+	var nextToken string
+	for {
+		req := map[string]string{"ResourceId": id}
+		if nextToken != "" {
+			req["NextToken"] = nextToken
+		}
+		var tags struct {
+			Tags      []orgTag `json:"Tags"`
+			NextToken string   `json:"NextToken"`
+		}
+		err = s.call(ctx, creds, "ListTagsForResource", req, &tags)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags.Tags {
+			a.tags[t.Key] = t.Value
+		}
+		if tags.NextToken == "" {
+			break
+		}
+		nextToken = tags.NextToken
+	}
+
+	a.ouPath, err = s.ouPath(ctx, creds, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// ouPath returns the path from the organization root to the account,
+// such as 'Root/Workloads/Production'.
+func (s *OrganizationsSource) ouPath(ctx context.Context, creds AWSCredentials, accountID string) (string, error) {
+	var names []string
+	child := accountID
+
+	// organizations can be nested at most 5 OUs deep, so this is a safeguard against loops.
+	for i := 0; i < 10; i++ {
+		var res struct {
+			Parents []orgParent `json:"Parents"`
+		}
+		err := s.call(ctx, creds, "ListParents", map[string]string{"ChildId": child}, &res)
+		if err != nil {
+			return "", err
+		}
+		if len(res.Parents) == 0 {
+			break
+		}
+
+		parent := res.Parents[0]
+		if parent.Type == "ROOT" {
+			names = append(names, "Root")
+			break
+		}
+
+		name, err := s.ouName(ctx, creds, parent.ID)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, name)
+		child = parent.ID
+	}
+
+	// names are from the account's parent up to the root.
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, "/"), nil
+}
+
+// ouName returns the name of an organizational unit, using the cache if possible.
+func (s *OrganizationsSource) ouName(ctx context.Context, creds AWSCredentials, id string) (string, error) {
+	s.mu.Lock()
+	name, ok := s.ouNames[id]
+	s.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	var res struct {
+		OrganizationalUnit struct {
+			Name string `json:"Name"`
+		} `json:"OrganizationalUnit"`
+	}
+	err := s.call(ctx, creds, "DescribeOrganizationalUnit", map[string]string{"OrganizationalUnitId": id}, &res)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.ouNames[id] = res.OrganizationalUnit.Name
+	s.mu.Unlock()
+	return res.OrganizationalUnit.Name, nil
+}
+
+// awsAPIError is an error returned by an AWS JSON API.
+type awsAPIError struct {
+	Type    string
+	Message string
+}
+
+func (e *awsAPIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// call calls an Organizations API operation and decodes the JSON response into out.
+func (s *OrganizationsSource) call(ctx context.Context, creds AWSCredentials, operation string, in any, out any) error {
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://organizations.%s.amazonaws.com", region)
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSOrganizationsV20161128."+operation)
+	signV4(req, body, creds, region, "organizations", time.Now())
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return organizationsError(res.StatusCode, data)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// organizationsError returns an error for an unsuccessful response from the Organizations API.
+// Throttling and server errors are marked as retryable.
+func organizationsError(status int, body []byte) error {
+	var res struct {
+		Type    string `json:"__type"`
+		Message string `json:"Message"`
+		// some errors use a lowercase message field
+		LowerMessage string `json:"message"`
+	}
+	if json.Unmarshal(body, &res) != nil || res.Type == "" {
+		return httpStatusError(status, body, fmt.Errorf("unexpected HTTP status %d: %s", status, strings.TrimSpace(string(body))))
+	}
+
+	// the type may be prefixed with a namespace, such as 'com.amazonaws.organizations#AccessDeniedException'.
+	if i := strings.LastIndex(res.Type, "#"); i >= 0 {
+		res.Type = res.Type[i+1:]
+	}
+	if res.Message == "" {
+		res.Message = res.LowerMessage
+	}
+
+	err := &awsAPIError{Type: res.Type, Message: res.Message}
+	if res.Type == "TooManyRequestsException" || res.Type == "ServiceException" || status >= 500 {
+		return RetryableError(err)
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package awsconfigfile
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOrganizations is a fake AWS Organizations API with the structure:
+//
+//	Root
+//	└── Workloads (ou-workloads)
+//	    ├── 111111111111 (active, tagged)
+//	    └── 222222222222 (suspended)
+type fakeOrganizations struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (f *fakeOrganizations) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AWSOrganizationsV20161128.")
+	f.mu.Lock()
+	f.calls[operation]++
+	f.mu.Unlock()
+
+	var req map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	var res any
+	switch operation {
+	case "DescribeAccount":
+		switch req["AccountId"] {
+		case "111111111111":
+			res = map[string]any{"Account": map[string]string{"Id": "111111111111", "Email": "prod@example.com", "Status": "ACTIVE"}}
+		case "222222222222":
+			res = map[string]any{"Account": map[string]string{"Id": "222222222222", "Email": "old@example.com", "Status": "SUSPENDED"}}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			res = map[string]string{"__type": "com.amazonaws.organizations#AccountNotFoundException", "Message": "not found"}
+		}
+	case "ListTagsForResource":
+		if req["ResourceId"] == "111111111111" {
+			if req["NextToken"] == "" {
+				res = map[string]any{"Tags": []orgTag{{Key: "environment", Value: "production"}}, "NextToken": "page2"}
+			} else {
+				res = map[string]any{"Tags": []orgTag{{Key: "team", Value: "payments"}}}
+			}
+		} else {
+			res = map[string]any{"Tags": []orgTag{}}
+		}
+	case "ListParents":
+		if req["ChildId"] == "ou-workloads" {
+			res = map[string]any{"Parents": []orgParent{{ID: "r-root", Type: "ROOT"}}}
+		} else {
+			res = map[string]any{"Parents": []orgParent{{ID: "ou-workloads", Type: "ORGANIZATIONAL_UNIT"}}}
+		}
+	case "DescribeOrganizationalUnit":
+		res = map[string]any{"OrganizationalUnit": map[string]string{"Id": "ou-workloads", "Name": "Workloads"}}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		res = map[string]string{"__type": "UnknownOperationException"}
+	}
+
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func testCredentials(ctx context.Context) (AWSCredentials, error) {
+	return AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+}
+
+func TestOrganizationsSource(t *testing.T) {
+	fake := &fakeOrganizations{calls: map[string]int{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	profiles := []SSOProfile{
+		{AccountID: "111111111111", AccountName: "prod", RoleName: "Admin", Metadata: Metadata{MetadataAccountEmail: "from-sso@example.com", "other": "kept"}},
+		{AccountID: "111111111111", AccountName: "prod", RoleName: "ReadOnly"},
+		{AccountID: "222222222222", AccountName: "old", RoleName: "Admin"},
+		{AccountID: "333333333333", AccountName: "external", RoleName: "Admin"},
+	}
+
+	s := &OrganizationsSource{
+		Source:        testSource{Profiles: profiles},
+		DropSuspended: true,
+		Endpoint:      server.URL,
+		Credentials:   testCredentials,
+	}
+
+	got, err := s.GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prodMetadata := Metadata{
+		MetadataOU:            "Root/Workloads",
+		MetadataAccountEmail:  "prod@example.com",
+		MetadataAccountStatus: "ACTIVE",
+		"tag:environment":     "production",
+		"tag:team":            "payments",
+	}
+	want := []SSOProfile{
+		{AccountID: "111111111111", AccountName: "prod", RoleName: "Admin", Metadata: prodMetadata.With("other", "kept")},
+		{AccountID: "111111111111", AccountName: "prod", RoleName: "ReadOnly", Metadata: prodMetadata},
+		{AccountID: "333333333333", AccountName: "external", RoleName: "Admin"},
+	}
+	assert.Equal(t, want, got)
+	// the original profile's metadata is not modified
+	assert.Equal(t, "from-sso@example.com", profiles[0].AccountEmail())
+
+	// accounts are cached between calls
+	assert.Equal(t, 3, fake.calls["DescribeAccount"])
+	calls := map[string]int{}
+	for k, v := range fake.calls {
+		calls[k] = v
+	}
+	_, err = s.GetProfiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, calls, fake.calls)
+}
+
+func TestOrganizationsSource_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type": "TooManyRequestsException", "Message": "slow down"}`))
+	}))
+	defer server.Close()
+
+	s := &OrganizationsSource{
+		Source:      testSource{Profiles: []SSOProfile{{AccountID: "111111111111"}}},
+		Endpoint:    server.URL,
+		Credentials: testCredentials,
+	}
+	_, err := s.GetProfiles(context.Background())
+	assert.EqualError(t, err, "describing account 111111111111: TooManyRequestsException: slow down")
+	assert.True(t, IsRetryable(err))
+}
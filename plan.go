@@ -0,0 +1,178 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/ini.v1"
+)
+
+// ChangeType describes how a config key was changed.
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeUpdated ChangeType = "updated"
+	ChangeRemoved ChangeType = "removed"
+)
+
+// KeyChange is a change to a single key in a config section.
+type KeyChange struct {
+	Key    string
+	Change ChangeType
+	// Before is the value of the key before merging.
+	// It is empty if the key was added.
+	Before string
+	// After is the value of the key after merging.
+	// It is empty if the key was removed.
+	After string
+}
+
+// SectionChange is a change to a config section, such as
+// 'profile prod/DevRole' or 'sso-session example'.
+type SectionChange struct {
+	Name string
+	Keys []KeyChange
+}
+
+// ChangeSet describes the changes that Merge would make to a config file.
+type ChangeSet struct {
+	// Added sections did not exist in the config file.
+	Added []SectionChange
+	// Updated sections existed in the config file and have different keys or values.
+	Updated []SectionChange
+	// Removed sections were pruned from the config file.
+	Removed []SectionChange
+	// Unchanged is the names of sections which were generated,
+	// but are identical to the existing sections in the config file.
+	Unchanged []string
+	// Collisions are profiles with the same name which were
+	// resolved using MergeOpts.CollisionStrategy.
+	Collisions []Collision
+	// Skipped is the invalid profiles which were skipped
+	// because MergeOpts.Validation is ValidationSkip.
+	Skipped []InvalidProfile
+
+	before string
+	after  string
+}
+
+// HasChanges returns true if merging would modify the config file.
+func (c *ChangeSet) HasChanges() bool {
+	return c.before != c.after
+}
+
+// WriteUnifiedDiff writes a unified diff between the config file before
+// and after merging. fromFile and toFile are used as the file names in the diff header.
+// Nothing is written if there are no changes.
+func (c *ChangeSet) WriteUnifiedDiff(w io.Writer, fromFile, toFile string) error {
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        difflib.SplitLines(c.before),
+		B:        difflib.SplitLines(c.after),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	})
+}
+
+// Plan returns the changes that Merge would make to opts.Config,
+// without modifying opts.Config.
+//
+// If opts.Lint is true, a *LintError is returned if the merged config file has errors.
+func Plan(opts MergeOpts) (*ChangeSet, error) {
+	original := opts.Config
+
+	var before bytes.Buffer
+	_, err := original.WriteTo(&before)
+	if err != nil {
+		return nil, err
+	}
+
+	planned, err := cloneConfig(original)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Config = planned
+	result, err := merge(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Lint {
+		err = lintMerged(planned)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var after bytes.Buffer
+	_, err = planned.WriteTo(&after)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := ChangeSet{
+		Collisions: result.Collisions,
+		Skipped:    result.Skipped,
+		before:     before.String(),
+		after:      after.String(),
+	}
+
+	written := map[string]bool{}
+	for _, name := range result.Written {
+		written[name] = true
+	}
+
+	for _, sec := range planned.Sections() {
+		existing, err := original.GetSection(sec.Name())
+		if err != nil {
+			cs.Added = append(cs.Added, SectionChange{Name: sec.Name(), Keys: diffKeys(nil, sec)})
+			continue
+		}
+
+		keys := diffKeys(existing, sec)
+		if len(keys) > 0 {
+			cs.Updated = append(cs.Updated, SectionChange{Name: sec.Name(), Keys: keys})
+		} else if written[sec.Name()] {
+			cs.Unchanged = append(cs.Unchanged, sec.Name())
+		}
+	}
+
+	for _, sec := range original.Sections() {
+		_, err := planned.GetSection(sec.Name())
+		if err != nil {
+			cs.Removed = append(cs.Removed, SectionChange{Name: sec.Name(), Keys: diffKeys(sec, nil)})
+		}
+	}
+
+	return &cs, nil
+}
+
+// diffKeys compares the keys in two sections.
+// Either section may be nil if it does not exist.
+func diffKeys(before, after *ini.Section) []KeyChange {
+	var changes []KeyChange
+
+	if after != nil {
+		for _, key := range after.Keys() {
+			if before == nil || !before.HasKey(key.Name()) {
+				changes = append(changes, KeyChange{Key: key.Name(), Change: ChangeAdded, After: keyFullValue(key)})
+				continue
+			}
+			if prev := keyFullValue(before.Key(key.Name())); prev != keyFullValue(key) {
+				changes = append(changes, KeyChange{Key: key.Name(), Change: ChangeUpdated, Before: prev, After: keyFullValue(key)})
+			}
+		}
+	}
+
+	if before != nil {
+		for _, key := range before.Keys() {
+			if after == nil || !after.HasKey(key.Name()) {
+				changes = append(changes, KeyChange{Key: key.Name(), Change: ChangeRemoved, Before: keyFullValue(key)})
+			}
+		}
+	}
+
+	return changes
+}
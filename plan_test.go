@@ -0,0 +1,178 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	config := `
+[profile handwritten]
+region = us-east-1
+
+[profile prod/DevRole]
+granted_sso_start_url      = https://example.awsapps.com/start
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 123456789012
+granted_sso_role_name      = DevRole
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile prod/DevRole
+region                     = us-east-1
+
+[profile prod/ReadOnly]
+granted_sso_start_url      = https://example.awsapps.com/start
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 123456789012
+granted_sso_role_name      = ReadOnly
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile prod/ReadOnly
+
+[profile removed/DevRole]
+granted_sso_start_url      = https://example.awsapps.com/start
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 210987654321
+granted_sso_role_name      = DevRole
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile removed/DevRole
+`
+	cfg := parseIni(t, config)
+
+	profile := func(account, role, region string) SSOProfile {
+		return SSOProfile{
+			SSOStartURL:   "https://example.awsapps.com/start",
+			SSORegion:     "ap-southeast-2",
+			AccountID:     "123456789012",
+			AccountName:   account,
+			RoleName:      role,
+			GeneratedFrom: "aws-sso",
+			Region:        region,
+		}
+	}
+
+	got, err := Plan(MergeOpts{
+		Config: cfg,
+		Profiles: []SSOProfile{
+			profile("prod", "DevRole", "us-west-2"),
+			profile("prod", "ReadOnly", ""),
+			profile("staging", "DevRole", ""),
+		},
+		PruneStartURLs: []string{"https://example.awsapps.com/start"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, got.HasChanges())
+
+	assert.Equal(t, []SectionChange{
+		{
+			Name: "profile staging/DevRole",
+			Keys: []KeyChange{
+				{Key: "granted_sso_start_url", Change: ChangeAdded, After: "https://example.awsapps.com/start"},
+				{Key: "granted_sso_region", Change: ChangeAdded, After: "ap-southeast-2"},
+				{Key: "granted_sso_account_id", Change: ChangeAdded, After: "123456789012"},
+				{Key: "granted_sso_role_name", Change: ChangeAdded, After: "DevRole"},
+				{Key: "common_fate_generated_from", Change: ChangeAdded, After: "aws-sso"},
+				{Key: "credential_process", Change: ChangeAdded, After: "granted credential-process --profile staging/DevRole"},
+			},
+		},
+	}, got.Added)
+
+	assert.Equal(t, []SectionChange{
+		{
+			Name: "profile prod/DevRole",
+			Keys: []KeyChange{
+				{Key: "region", Change: ChangeUpdated, Before: "us-east-1", After: "us-west-2"},
+			},
+		},
+	}, got.Updated)
+
+	assert.Len(t, got.Removed, 1)
+	assert.Equal(t, "profile removed/DevRole", got.Removed[0].Name)
+	assert.Equal(t, []string{"profile prod/ReadOnly"}, got.Unchanged)
+
+	// the config must not be modified
+	var b bytes.Buffer
+	_, err = cfg.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, strings.TrimSpace(config), strings.TrimSpace(b.String()))
+
+	var diff bytes.Buffer
+	err = got.WriteUnifiedDiff(&diff, "config", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, diff.String(), "-region                     = us-east-1\n+region                     = us-west-2\n")
+	assert.Contains(t, diff.String(), "-[profile removed/DevRole]\n")
+	assert.Contains(t, diff.String(), "+[profile staging/DevRole]\n")
+}
+
+func TestPlan_NoChanges(t *testing.T) {
+	got, err := Plan(MergeOpts{
+		Config: parseIni(t, `
+[profile prod/DevRole]
+granted_sso_start_url      = https://example.awsapps.com/start
+granted_sso_region         = ap-southeast-2
+granted_sso_account_id     = 123456789012
+granted_sso_role_name      = DevRole
+common_fate_generated_from = aws-sso
+credential_process         = granted credential-process --profile prod/DevRole
+`),
+		Profiles: []SSOProfile{
+			{
+				SSOStartURL:   "https://example.awsapps.com/start",
+				SSORegion:     "ap-southeast-2",
+				AccountID:     "123456789012",
+				AccountName:   "prod",
+				RoleName:      "DevRole",
+				GeneratedFrom: "aws-sso",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, got.HasChanges())
+	assert.Empty(t, got.Added)
+	assert.Empty(t, got.Updated)
+	assert.Empty(t, got.Removed)
+	assert.Equal(t, []string{"profile prod/DevRole"}, got.Unchanged)
+
+	var diff bytes.Buffer
+	err = got.WriteUnifiedDiff(&diff, "config", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, diff.String())
+}
+
+func TestPlan_NestedValues(t *testing.T) {
+	got, err := Plan(MergeOpts{
+		Config: parseIni(t, `
+[profile manual]
+region = us-east-1
+s3 =
+  max_concurrent_requests = 20
+  max_queue_size = 1000
+`),
+		NoCredentialProcess: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, got.HasChanges())
+
+	var diff bytes.Buffer
+	err = got.WriteUnifiedDiff(&diff, "config", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, diff.String())
+}
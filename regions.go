@@ -0,0 +1,64 @@
+package awsconfigfile
+
+import "regexp"
+
+// knownRegions are the AWS regions, including the China, GovCloud and ISO partitions.
+// Regions launched after this list was updated are reported as unknown rather than invalid.
+var knownRegions = map[string]bool{
+	"af-south-1":     true,
+	"ap-east-1":      true,
+	"ap-east-2":      true,
+	"ap-northeast-1": true,
+	"ap-northeast-2": true,
+	"ap-northeast-3": true,
+	"ap-south-1":     true,
+	"ap-south-2":     true,
+	"ap-southeast-1": true,
+	"ap-southeast-2": true,
+	"ap-southeast-3": true,
+	"ap-southeast-4": true,
+	"ap-southeast-5": true,
+	"ap-southeast-6": true,
+	"ap-southeast-7": true,
+	"ca-central-1":   true,
+	"ca-west-1":      true,
+	"cn-north-1":     true,
+	"cn-northwest-1": true,
+	"eu-central-1":   true,
+	"eu-central-2":   true,
+	"eu-north-1":     true,
+	"eu-south-1":     true,
+	"eu-south-2":     true,
+	"eu-west-1":      true,
+	"eu-west-2":      true,
+	"eu-west-3":      true,
+	"eusc-de-east-1": true,
+	"il-central-1":   true,
+	"me-central-1":   true,
+	"me-south-1":     true,
+	"mx-central-1":   true,
+	"sa-east-1":      true,
+	"us-east-1":      true,
+	"us-east-2":      true,
+	"us-gov-east-1":  true,
+	"us-gov-west-1":  true,
+	"us-iso-east-1":  true,
+	"us-iso-west-1":  true,
+	"us-isob-east-1": true,
+	"us-west-1":      true,
+	"us-west-2":      true,
+}
+
+// regionPattern matches well-formed region names, such as 'us-east-1' and 'us-gov-west-1'.
+var regionPattern = regexp.MustCompile(`^[a-z]{2,4}(-[a-z]+)+-[0-9]+$`)
+
+// IsKnownRegion returns true if region is a known AWS region.
+func IsKnownRegion(region string) bool {
+	return knownRegions[region]
+}
+
+// isValidRegionName returns true if region is formatted like an AWS region name,
+// whether or not the region is known.
+func isValidRegionName(region string) bool {
+	return regionPattern.MatchString(region)
+}
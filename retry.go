@@ -0,0 +1,97 @@
+package awsconfigfile
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy controls how a source is retried when it returns a retryable error.
+// Errors are retryable if they implement `Retryable() bool` and return true,
+// such as errors wrapped with RetryableError.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times to load the source,
+	// including the first attempt. Zero or one disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	// The delay is doubled after each retry. Defaults to 500ms.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between retries. Defaults to 10s.
+	MaxBackoff time.Duration
+}
+
+// SourceOptions override the generator's timeout and retry policy for a single source.
+type SourceOptions struct {
+	// Timeout is the deadline for loading the source, including any retries.
+	// If zero, Generator.SourceTimeout is used.
+	Timeout time.Duration
+	// Retry is the retry policy for the source.
+	// If nil, Generator.Retry is used.
+	Retry *RetryPolicy
+}
+
+// SourceOptionsProvider is an optional interface which a Source may implement
+// to override the generator's timeout and retry policy.
+type SourceOptionsProvider interface {
+	SourceOptions() SourceOptions
+}
+
+// RetryableError marks err as retryable, so that the source
+// is retried according to the RetryPolicy.
+func RetryableError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string   { return e.err.Error() }
+func (e *retryableError) Unwrap() error   { return e.err }
+func (e *retryableError) Retryable() bool { return true }
+
+// IsRetryable returns true if err, or any error that it wraps,
+// implements `Retryable() bool` and returns true.
+func IsRetryable(err error) bool {
+	var r interface{ Retryable() bool }
+	return errors.As(err, &r) && r.Retryable()
+}
+
+// retry calls fn until it succeeds, returns an error which isn't retryable,
+// the policy's attempts are exhausted, or the context is cancelled.
+func retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	backoff := policy.InitialBackoff
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 10 * time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= policy.MaxAttempts || !IsRetryable(err) {
+			return err
+		}
+
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// return the source's error rather than the context error,
+			// as it is more useful for diagnosing the failure.
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
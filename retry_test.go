@@ -0,0 +1,172 @@
+package awsconfigfile
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		errs         []error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "succeeds after retryable errors",
+			policy:       RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			errs:         []error{RetryableError(errors.New("throttled")), RetryableError(errors.New("throttled")), nil},
+			wantAttempts: 3,
+		},
+		{
+			name:         "does not retry other errors",
+			policy:       RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			errs:         []error{errors.New("access denied")},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "gives up after max attempts",
+			policy:       RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+			errs:         []error{RetryableError(errors.New("throttled")), RetryableError(errors.New("throttled")), nil},
+			wantAttempts: 2,
+			wantErr:      true,
+		},
+		{
+			name:         "retries are disabled by default",
+			errs:         []error{RetryableError(errors.New("throttled")), nil},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			err := retry(context.Background(), tt.policy, func(ctx context.Context) error {
+				err := tt.errs[attempts]
+				attempts++
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("retry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
+
+// flakySource fails with a retryable error until it has been called failures times.
+type flakySource struct {
+	mu       sync.Mutex
+	calls    int
+	failures int
+	opts     SourceOptions
+}
+
+func (s *flakySource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.calls <= s.failures {
+		return nil, RetryableError(errors.New("throttled"))
+	}
+	return []SSOProfile{{AccountName: "prod", RoleName: "DevRole", GeneratedFrom: "aws-sso"}}, nil
+}
+
+func (s *flakySource) SourceOptions() SourceOptions {
+	return s.opts
+}
+
+// slowSource blocks until the context is cancelled.
+type slowSource struct{}
+
+func (slowSource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// concurrencySource records the maximum number of concurrent calls.
+type concurrencySource struct {
+	mu      *sync.Mutex
+	current *int
+	max     *int
+}
+
+func (s concurrencySource) GetProfiles(ctx context.Context) ([]SSOProfile, error) {
+	s.mu.Lock()
+	*s.current++
+	if *s.current > *s.max {
+		*s.max = *s.current
+	}
+	s.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	s.mu.Lock()
+	*s.current--
+	s.mu.Unlock()
+	return nil, nil
+}
+
+func TestGenerator_Retry(t *testing.T) {
+	src := &flakySource{
+		failures: 2,
+		opts:     SourceOptions{Retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}},
+	}
+	g := &Generator{Sources: []Source{src}, Config: parseIni(t, "")}
+
+	err := g.Generate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, src.calls)
+	assert.True(t, g.Config.HasSection("profile prod/DevRole"))
+}
+
+func TestGenerator_SourceTimeout(t *testing.T) {
+	g := &Generator{
+		Sources:       []Source{slowSource{}},
+		Config:        parseIni(t, ""),
+		SourceTimeout: 10 * time.Millisecond,
+	}
+
+	err := g.Generate(context.Background())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected context.DeadlineExceeded, got %v", err)
+}
+
+func TestGenerator_MaxConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var current, maxSeen int
+
+	g := &Generator{Config: parseIni(t, ""), MaxConcurrency: 2}
+	for i := 0; i < 6; i++ {
+		g.AddSource(concurrencySource{mu: &mu, current: &current, max: &maxSeen})
+	}
+
+	err := g.Generate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.LessOrEqual(t, maxSeen, 2)
+}
+
+func TestGenerator_SourceErrorCancelsOtherSources(t *testing.T) {
+	g := &Generator{
+		Sources: []Source{slowSource{}, failingSource{}},
+		Config:  parseIni(t, ""),
+	}
+
+	start := time.Now()
+	err := g.Generate(context.Background())
+	var srcErr *SourceError
+	if assert.True(t, errors.As(err, &srcErr), "expected a *SourceError, got %v", err) {
+		assert.Equal(t, "failing", srcErr.Source)
+	}
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,159 @@
+package awsconfigfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// SwitchRolesOpts are the options for exporting profiles
+// to the AWS Extend Switch Roles browser extension.
+type SwitchRolesOpts struct {
+	// RoleARNTemplate is executed with each SSOProfile to build its role_arn.
+	// Defaults to 'arn:aws:iam::{{ .AccountID }}:role/{{ .RoleName }}', which assumes that
+	// a role with the same name as the SSO role exists in each account.
+	// Assume role profiles always use their own RoleARN.
+	RoleARNTemplate string
+	// ColorTag is the metadata tag used to choose the color of each profile, such as 'environment'.
+	ColorTag string
+	// Colors maps values of ColorTag to colors, written as six digit hex codes such as 'ff0000'.
+	Colors map[string]string
+	// DefaultColor is used for profiles whose ColorTag value is not in Colors.
+	// If empty, the extension's default color is used.
+	DefaultColor string
+}
+
+// hexColorPattern matches the colors accepted by the extension.
+var hexColorPattern = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+
+// ExportSwitchRoles writes the configuration for the AWS Extend Switch Roles browser extension
+// for the profiles that Merge would write with opts, so that profiles have the same names
+// in the AWS console as in the CLI. opts.Config is not modified, and may be nil.
+//
+// Profiles are grouped by the source they were generated from, with a comment before each group:
+//
+//	; aws-sso
+//	[profile prod/DevRole]
+//	role_arn = arn:aws:iam::123456789012:role/DevRole
+//	color = ff0000
+func ExportSwitchRoles(w io.Writer, opts MergeOpts, sr SwitchRolesOpts) error {
+	for value, color := range sr.Colors {
+		if !hexColorPattern.MatchString(color) {
+			return fmt.Errorf("color %q for %s %q must be a six digit hex code", color, sr.ColorTag, value)
+		}
+	}
+	if sr.DefaultColor != "" && !hexColorPattern.MatchString(sr.DefaultColor) {
+		return fmt.Errorf("default color %q must be a six digit hex code", sr.DefaultColor)
+	}
+
+	var roleARNTempl *template.Template
+	if sr.RoleARNTemplate != "" {
+		var err error
+		roleARNTempl, err = template.New("").Funcs(sprig.TxtFuncMap()).Parse(sr.RoleARNTemplate)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the profiles are merged into a copy of the config, so that
+	// they are named and filtered in exactly the same way as by Merge.
+	config, err := cloneConfig(opts.Config)
+	if err != nil {
+		return err
+	}
+	opts.Config = config
+
+	result, err := merge(opts)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string][]profileEntry{}
+	for _, entry := range result.Entries {
+		var from string
+		switch p := entry.Profile.(type) {
+		case SSOProfile:
+			from = p.GeneratedFrom
+		case AssumeRoleProfile:
+			from = p.GeneratedFrom
+		}
+		groups[from] = append(groups[from], entry)
+	}
+
+	var sources []string
+	for s := range groups {
+		sources = append(sources, s)
+	}
+	sort.Strings(sources)
+
+	bw := bufio.NewWriter(w)
+	for i, source := range sources {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		if source != "" {
+			fmt.Fprintf(bw, "; %s\n", source)
+		}
+
+		for j, entry := range groups[source] {
+			if j > 0 {
+				fmt.Fprintln(bw)
+			}
+			keys, err := sr.keys(entry, roleARNTempl)
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", entry.ProfileName, err)
+			}
+			fmt.Fprintf(bw, "[profile %s]\n", entry.ProfileName)
+			for _, kv := range keys {
+				fmt.Fprintf(bw, "%s = %s\n", kv.Key, kv.Value)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// keys returns the extension's keys for a profile.
+func (sr SwitchRolesOpts) keys(entry profileEntry, roleARNTempl *template.Template) ([]KeyValue, error) {
+	var roleARN, region string
+	var metadata Metadata
+
+	switch p := entry.Profile.(type) {
+	case SSOProfile:
+		roleARN = fmt.Sprintf("arn:aws:iam::%s:role/%s", p.AccountID, p.RoleName)
+		if roleARNTempl != nil {
+			var buf strings.Builder
+			err := roleARNTempl.Execute(&buf, p)
+			if err != nil {
+				return nil, err
+			}
+			roleARN = buf.String()
+		}
+		region, metadata = p.Region, p.Metadata
+	case AssumeRoleProfile:
+		roleARN = p.RoleARN
+		if roleARN == "" {
+			roleARN = fmt.Sprintf("arn:aws:iam::%s:role/%s", p.AccountID, p.RoleName)
+		}
+		region, metadata = p.Region, p.Metadata
+	}
+
+	keys := []KeyValue{{Key: "role_arn", Value: roleARN}}
+
+	color := sr.DefaultColor
+	if c, ok := sr.Colors[metadata.Tag(sr.ColorTag)]; ok && sr.ColorTag != "" {
+		color = c
+	}
+	if color != "" {
+		keys = append(keys, KeyValue{Key: "color", Value: strings.ToLower(color)})
+	}
+	if region != "" {
+		keys = append(keys, KeyValue{Key: "region", Value: region})
+	}
+	return keys, nil
+}
@@ -0,0 +1,184 @@
+package awsconfigfile
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportSwitchRoles(t *testing.T) {
+	prod := SSOProfile{
+		SSOStartURL:   "https://example.awsapps.com/start",
+		SSORegion:     "ap-southeast-2",
+		Region:        "us-west-2",
+		AccountID:     "123456789012",
+		AccountName:   "prod",
+		RoleName:      "DevRole",
+		GeneratedFrom: "aws-sso",
+		Metadata:      Metadata{MetadataTagPrefix + "environment": "production"},
+	}
+	dev := SSOProfile{
+		SSOStartURL:   "https://example.awsapps.com/start",
+		SSORegion:     "ap-southeast-2",
+		AccountID:     "210987654321",
+		AccountName:   "dev",
+		RoleName:      "DevRole",
+		GeneratedFrom: "aws-sso",
+		Metadata:      Metadata{MetadataTagPrefix + "environment": "development"},
+	}
+	breakGlass := SSOProfile{
+		SSOStartURL:   "https://example.awsapps.com/start",
+		SSORegion:     "ap-southeast-2",
+		AccountID:     "123456789012",
+		AccountName:   "prod",
+		RoleName:      "BreakGlass",
+		GeneratedFrom: "file",
+	}
+	deploy := AssumeRoleProfile{
+		AccountID:     "333333333333",
+		AccountName:   "tooling",
+		RoleName:      "Deploy",
+		SourceProfile: "prod/DevRole",
+		GeneratedFrom: "aws-sso",
+	}
+
+	tests := []struct {
+		name    string
+		opts    MergeOpts
+		sr      SwitchRolesOpts
+		want    string
+		wantErr string
+	}{
+		{
+			name: "grouped by source",
+			opts: MergeOpts{
+				Profiles:           []SSOProfile{prod, breakGlass, dev},
+				AssumeRoleProfiles: []AssumeRoleProfile{deploy},
+			},
+			want: `; aws-sso
+[profile dev/DevRole]
+role_arn = arn:aws:iam::210987654321:role/DevRole
+
+[profile prod/DevRole]
+role_arn = arn:aws:iam::123456789012:role/DevRole
+region = us-west-2
+
+[profile tooling/Deploy]
+role_arn = arn:aws:iam::333333333333:role/Deploy
+
+; file
+[profile prod/BreakGlass]
+role_arn = arn:aws:iam::123456789012:role/BreakGlass
+`,
+		},
+		{
+			name: "colors by tag",
+			opts: MergeOpts{Profiles: []SSOProfile{prod, dev, breakGlass}},
+			sr: SwitchRolesOpts{
+				ColorTag:     "environment",
+				Colors:       map[string]string{"production": "FF0000", "development": "00ff00"},
+				DefaultColor: "aaaaaa",
+			},
+			want: `; aws-sso
+[profile dev/DevRole]
+role_arn = arn:aws:iam::210987654321:role/DevRole
+color = 00ff00
+
+[profile prod/DevRole]
+role_arn = arn:aws:iam::123456789012:role/DevRole
+color = ff0000
+region = us-west-2
+
+; file
+[profile prod/BreakGlass]
+role_arn = arn:aws:iam::123456789012:role/BreakGlass
+color = aaaaaa
+`,
+		},
+		{
+			name: "same names as merge",
+			opts: MergeOpts{
+				Config:              parseIni(t, "[profile cf-prod/DevRole]\nregion = us-east-1\n"),
+				Profiles:            []SSOProfile{prod},
+				Prefix:              "cf-",
+				SectionNameTemplate: `{{ .AccountName }}/{{ .RoleName }}`,
+				CollisionStrategy:   CollisionSuffixAccountID,
+			},
+			sr: SwitchRolesOpts{RoleARNTemplate: "arn:aws:iam::{{ .AccountID }}:role/sso/{{ .RoleName }}"},
+			want: `; aws-sso
+[profile cf-prod/DevRole-123456789012]
+role_arn = arn:aws:iam::123456789012:role/sso/DevRole
+region = us-west-2
+`,
+		},
+		{
+			name:    "invalid color",
+			opts:    MergeOpts{Profiles: []SSOProfile{prod}},
+			sr:      SwitchRolesOpts{ColorTag: "environment", Colors: map[string]string{"production": "red"}},
+			wantErr: `color "red" for environment "production" must be a six digit hex code`,
+		},
+		{
+			name:    "merge errors are returned",
+			opts:    MergeOpts{Profiles: []SSOProfile{prod, prod}},
+			wantErr: "profile names collide",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before string
+			if tt.opts.Config != nil {
+				before = iniString(t, tt.opts)
+			}
+
+			var buf bytes.Buffer
+			err := ExportSwitchRoles(&buf, tt.opts, tt.sr)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, buf.String())
+
+			if tt.opts.Config != nil {
+				assert.Equal(t, before, iniString(t, tt.opts), "the config must not be modified")
+			}
+		})
+	}
+}
+
+func iniString(t *testing.T, opts MergeOpts) string {
+	var buf bytes.Buffer
+	_, err := opts.Config.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestGenerator_ExportSwitchRoles(t *testing.T) {
+	src := &FileSource{Paths: []string{writeTestFile(t, t.TempDir(), "profiles.yaml", `
+profiles:
+  - sso_start_url: https://example.awsapps.com/start
+    sso_region: ap-southeast-2
+    account_id: "123456789012"
+    account_name: prod
+    role_name: DevRole
+`)}}
+	g := &Generator{Sources: []Source{src}, Prefix: "cf-"}
+
+	var buf bytes.Buffer
+	err := g.ExportSwitchRoles(context.Background(), &buf, SwitchRolesOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `; file
+[profile cf-prod/DevRole]
+role_arn = arn:aws:iam::123456789012:role/DevRole
+`, buf.String())
+}
@@ -0,0 +1,134 @@
+package awsconfigfile
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ValidationMode controls how Merge handles invalid profiles.
+type ValidationMode string
+
+const (
+	// ValidationFail causes Merge to return an *InvalidProfilesError
+	// without modifying the config file if any profiles are invalid.
+	ValidationFail ValidationMode = "fail"
+	// ValidationSkip skips invalid profiles and merges the valid ones.
+	// Skipped profiles are reported in ChangeSet.Skipped.
+	ValidationSkip ValidationMode = "skip"
+	// ValidationOff writes profiles without validating them.
+	// This is the default if no validation mode is set.
+	ValidationOff ValidationMode = "off"
+)
+
+// iamRoleNamePattern matches valid IAM role names.
+var iamRoleNamePattern = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
+
+// Validate returns an error describing every invalid field of the profile.
+// The account ID must be 12 digits, the SSO start URL must be an https URL,
+// the SSO region and region must be known AWS regions and the role name must be a valid IAM role name.
+//
+// extraRegions are accepted in addition to the known AWS regions,
+// such as regions which were launched after this package was released.
+func (p SSOProfile) Validate(extraRegions ...string) error {
+	problems := p.validate(stringSet(extraRegions))
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+func (p SSOProfile) validate(extraRegions map[string]bool) []string {
+	var problems []string
+
+	if !isValidAccountID(p.AccountID) {
+		problems = append(problems, fmt.Sprintf("account ID %q must be 12 digits", p.AccountID))
+	}
+
+	u, err := url.Parse(p.SSOStartURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("SSO start URL %q must be an https URL", p.SSOStartURL))
+	}
+
+	if p.SSORegion == "" {
+		problems = append(problems, "SSO region is empty")
+	} else if !IsKnownRegion(p.SSORegion) && !extraRegions[p.SSORegion] {
+		problems = append(problems, fmt.Sprintf("SSO region %q is not a known region", p.SSORegion))
+	}
+	// the region is optional, as it is only written to the profile if it is set.
+	if p.Region != "" && !IsKnownRegion(p.Region) && !extraRegions[p.Region] {
+		problems = append(problems, fmt.Sprintf("region %q is not a known region", p.Region))
+	}
+
+	if p.RoleName == "" {
+		problems = append(problems, "role name is empty")
+	} else if !iamRoleNamePattern.MatchString(p.RoleName) {
+		problems = append(problems, fmt.Sprintf("role name %q is not a valid IAM role name", p.RoleName))
+	}
+
+	return problems
+}
+
+// InvalidProfile is a profile which failed validation.
+type InvalidProfile struct {
+	// Source is the source which returned the profile. Merge uses the
+	// profile's GeneratedFrom, and Generator uses the name of the source.
+	Source   string
+	Profile  SSOProfile
+	Problems []string
+}
+
+func (p InvalidProfile) String() string {
+	msg := fmt.Sprintf("profile for account %q and role %q: %s", p.Profile.AccountID, p.Profile.RoleName, strings.Join(p.Problems, ", "))
+	if p.Source == "" {
+		return msg
+	}
+	return p.Source + ": " + msg
+}
+
+// InvalidProfilesError is returned if any profiles are invalid
+// and the validation mode is ValidationFail.
+type InvalidProfilesError struct {
+	Profiles []InvalidProfile
+}
+
+func (e *InvalidProfilesError) Error() string {
+	var msgs []string
+	for _, p := range e.Profiles {
+		msgs = append(msgs, p.String())
+	}
+	return fmt.Sprintf("%d invalid profiles: %s", len(e.Profiles), strings.Join(msgs, "; "))
+}
+
+// validateProfiles validates profiles using the validation mode, returning the valid profiles
+// and the invalid profiles. source returns the name of the source which returned each profile.
+// An *InvalidProfilesError is returned if the mode is ValidationFail and any profiles are invalid.
+func validateProfiles(profiles []SSOProfile, mode ValidationMode, extraRegions []string, source func(i int) string) ([]SSOProfile, []InvalidProfile, error) {
+	switch mode {
+	case ValidationFail, ValidationSkip:
+	case "", ValidationOff:
+		return profiles, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid validation mode %q", mode)
+	}
+
+	regions := stringSet(extraRegions)
+	var valid []SSOProfile
+	var invalid []InvalidProfile
+
+	for i, p := range profiles {
+		problems := p.validate(regions)
+		if len(problems) == 0 {
+			valid = append(valid, p)
+			continue
+		}
+		invalid = append(invalid, InvalidProfile{Source: source(i), Profile: p, Problems: problems})
+	}
+
+	if len(invalid) > 0 && mode != ValidationSkip {
+		return nil, nil, &InvalidProfilesError{Profiles: invalid}
+	}
+	return valid, invalid, nil
+}
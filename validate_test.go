@@ -0,0 +1,220 @@
+package awsconfigfile
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validTestProfile() SSOProfile {
+	return SSOProfile{
+		SSOStartURL:   "https://example.awsapps.com/start",
+		SSORegion:     "ap-southeast-2",
+		Region:        "us-west-2",
+		AccountID:     "123456789012",
+		AccountName:   "prod",
+		RoleName:      "DevRole",
+		GeneratedFrom: "aws-sso",
+	}
+}
+
+func TestSSOProfile_Validate(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(p *SSOProfile)
+		extraRegions []string
+		wantErr      string
+	}{
+		{
+			name:   "valid",
+			modify: func(p *SSOProfile) {},
+		},
+		{
+			name:    "empty account ID",
+			modify:  func(p *SSOProfile) { p.AccountID = "" },
+			wantErr: `account ID "" must be 12 digits`,
+		},
+		{
+			name:    "11 digit account ID",
+			modify:  func(p *SSOProfile) { p.AccountID = "12345678901" },
+			wantErr: `account ID "12345678901" must be 12 digits`,
+		},
+		{
+			name:    "http start URL",
+			modify:  func(p *SSOProfile) { p.SSOStartURL = "http://example.awsapps.com/start" },
+			wantErr: `SSO start URL "http://example.awsapps.com/start" must be an https URL`,
+		},
+		{
+			name:    "malformed start URL",
+			modify:  func(p *SSOProfile) { p.SSOStartURL = "example.awsapps.com/start" },
+			wantErr: `SSO start URL "example.awsapps.com/start" must be an https URL`,
+		},
+		{
+			name:    "misspelled SSO region",
+			modify:  func(p *SSOProfile) { p.SSORegion = "ap-southest-2" },
+			wantErr: `SSO region "ap-southest-2" is not a known region`,
+		},
+		{
+			name:    "empty SSO region",
+			modify:  func(p *SSOProfile) { p.SSORegion = "" },
+			wantErr: "SSO region is empty",
+		},
+		{
+			name:   "empty region",
+			modify: func(p *SSOProfile) { p.Region = "" },
+		},
+		{
+			name:    "unknown region",
+			modify:  func(p *SSOProfile) { p.Region = "xx-north-9" },
+			wantErr: `region "xx-north-9" is not a known region`,
+		},
+		{
+			name:         "extra region",
+			modify:       func(p *SSOProfile) { p.Region = "xx-north-9" },
+			extraRegions: []string{"xx-north-9"},
+		},
+		{
+			name:    "empty role name",
+			modify:  func(p *SSOProfile) { p.RoleName = "" },
+			wantErr: "role name is empty",
+		},
+		{
+			name:    "invalid role name",
+			modify:  func(p *SSOProfile) { p.RoleName = "Dev Role" },
+			wantErr: `role name "Dev Role" is not a valid IAM role name`,
+		},
+		{
+			name: "every problem is reported",
+			modify: func(p *SSOProfile) {
+				p.AccountID = ""
+				p.RoleName = ""
+			},
+			wantErr: `account ID "" must be 12 digits, role name is empty`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := validTestProfile()
+			tt.modify(&p)
+
+			err := p.Validate(tt.extraRegions...)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMerge_Validation(t *testing.T) {
+	invalid := validTestProfile()
+	invalid.AccountName = "broken"
+	invalid.SSORegion = "ap-southest-2"
+
+	config := `[profile broken/DevRole]
+sso_start_url              = https://example.awsapps.com/start
+sso_region                 = ap-southeast-2
+sso_account_id             = 123456789012
+sso_role_name              = DevRole
+common_fate_generated_from = aws-sso
+`
+
+	t.Run("fail", func(t *testing.T) {
+		cfg := parseIni(t, config)
+		err := Merge(MergeOpts{Config: cfg, Profiles: []SSOProfile{validTestProfile(), invalid}, NoCredentialProcess: true, Validation: ValidationFail})
+
+		var ipe *InvalidProfilesError
+		if assert.True(t, errors.As(err, &ipe), err) {
+			assert.Equal(t, []InvalidProfile{{Source: "aws-sso", Profile: invalid, Problems: []string{`SSO region "ap-southest-2" is not a known region`}}}, ipe.Profiles)
+		}
+		assert.EqualError(t, err, `1 invalid profiles: aws-sso: profile for account "123456789012" and role "DevRole": SSO region "ap-southest-2" is not a known region`)
+		assert.False(t, cfg.HasSection("profile prod/DevRole"))
+	})
+
+	t.Run("skip keeps existing profiles", func(t *testing.T) {
+		opts := MergeOpts{
+			Config:              parseIni(t, config),
+			Profiles:            []SSOProfile{validTestProfile(), invalid},
+			NoCredentialProcess: true,
+			PruneStartURLs:      []string{"https://example.awsapps.com/start"},
+			Validation:          ValidationSkip,
+		}
+
+		cs, err := Plan(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, cs.Skipped, 1)
+		assert.Empty(t, cs.Removed)
+
+		err = Merge(opts)
+		var partialErr *PartialFailureError
+		if assert.True(t, errors.As(err, &partialErr), err) {
+			assert.Equal(t, cs.Skipped, partialErr.Skipped)
+		}
+		assert.True(t, opts.Config.HasSection("profile prod/DevRole"))
+		assert.Equal(t, "ap-southeast-2", opts.Config.Section("profile broken/DevRole").Key("sso_region").String())
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		cfg := parseIni(t, "")
+		err := Merge(MergeOpts{Config: cfg, Profiles: []SSOProfile{invalid}, NoCredentialProcess: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "ap-southest-2", cfg.Section("profile broken/DevRole").Key("sso_region").String())
+	})
+
+	t.Run("extra regions", func(t *testing.T) {
+		cfg := parseIni(t, "")
+		err := Merge(MergeOpts{Config: cfg, Profiles: []SSOProfile{invalid}, NoCredentialProcess: true, Validation: ValidationFail, ExtraRegions: []string{"ap-southest-2"}})
+		assert.NoError(t, err)
+	})
+}
+
+func TestGenerator_Validation(t *testing.T) {
+	src := &FileSource{Paths: []string{writeTestFile(t, t.TempDir(), "profiles.yaml", `
+profiles:
+  - sso_start_url: https://example.awsapps.com/start
+    sso_region: ap-southeast-2
+    account_id: "12345678901"
+    account_name: prod
+    role_name: DevRole
+`)}}
+
+	// profiles are not validated by default.
+	g := &Generator{Sources: []Source{src}, Config: parseIni(t, "")}
+	cs, err := g.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, cs.Added, 1)
+
+	g.Validation = ValidationFail
+	_, err = g.Plan(context.Background())
+
+	var ipe *InvalidProfilesError
+	if assert.True(t, errors.As(err, &ipe), err) && assert.Len(t, ipe.Profiles, 1) {
+		assert.Equal(t, src.Name(), ipe.Profiles[0].Source)
+	}
+
+	g.Validation = ValidationSkip
+	cs, err = g.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, cs.Skipped, 1) {
+		assert.Equal(t, src.Name(), cs.Skipped[0].Source)
+	}
+	assert.Empty(t, cs.Added)
+
+	// Generate reports the skipped profiles after merging the valid ones.
+	err = g.Generate(context.Background())
+	var partialErr *PartialFailureError
+	if assert.True(t, errors.As(err, &partialErr), err) && assert.Len(t, partialErr.Skipped, 1) {
+		assert.Equal(t, src.Name(), partialErr.Skipped[0].Source)
+	}
+}